@@ -0,0 +1,187 @@
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+)
+
+const (
+	// CircuitClosed is the state of a healthy backend
+	CircuitClosed = "closed"
+
+	// CircuitOpen is the state of a failing backend: requests fail fast
+	CircuitOpen = "open"
+
+	// CircuitHalfOpen is the state of a backend being probed after the cooldown
+	CircuitHalfOpen = "half-open"
+)
+
+var (
+	// ErrCircuitOpen is returned when the backend circuit is open
+	ErrCircuitOpen = errors.New("Backend server is unavailable (circuit open)")
+)
+
+// Breaker is a circuit breaker for a backend
+type Breaker struct {
+	Threshold int
+	Cooldown  time.Duration
+
+	mutex    sync.Mutex
+	state    string
+	failures int
+	openedAt time.Time
+	trial    bool
+}
+
+// BreakerStatus is a snapshot of a circuit breaker
+type BreakerStatus struct {
+	State    string     `json:"state"`
+	Failures int        `json:"failures"`
+	OpenedAt *time.Time `json:"openedAt,omitempty"`
+}
+
+// Allow tells if a request to the backend might be done
+func (b *Breaker) Allow() bool {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	switch b.state {
+	case CircuitOpen:
+		if time.Since(b.openedAt) < b.Cooldown {
+			return false
+		}
+
+		b.state = CircuitHalfOpen
+		b.trial = true
+		return true
+	case CircuitHalfOpen:
+		if b.trial {
+			return false
+		}
+
+		b.trial = true
+	}
+
+	return true
+}
+
+// Success registers a request that reached a healthy backend
+func (b *Breaker) Success() {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.state = CircuitClosed
+	b.failures = 0
+	b.trial = false
+}
+
+// Failure registers a request that failed due to the backend
+func (b *Breaker) Failure() {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.failures++
+	b.trial = false
+
+	if b.state == CircuitHalfOpen || (b.Threshold > 0 && b.failures >= b.Threshold) {
+		b.state = CircuitOpen
+		b.openedAt = time.Now()
+	}
+}
+
+// Release the trial request of a half-open circuit that ended without telling the backend health (i.e., it was canceled)
+// so that another request can probe the backend
+func (b *Breaker) Release() {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.trial = false
+}
+
+// Status of the circuit breaker
+func (b *Breaker) Status() BreakerStatus {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	s := BreakerStatus{
+		State:    b.state,
+		Failures: b.failures,
+	}
+
+	if s.State == "" {
+		s.State = CircuitClosed
+	}
+
+	if s.State != CircuitClosed {
+		openedAt := b.openedAt
+		s.OpenedAt = &openedAt
+	}
+
+	return s
+}
+
+// Circuits is a set of circuit breakers, one per backend host
+// A zero Threshold disables the circuit breakers
+type Circuits struct {
+	Threshold int
+	Cooldown  time.Duration
+
+	mutex    sync.Mutex
+	breakers map[string]*Breaker
+}
+
+// Breaker for a given backend host
+func (c *Circuits) Breaker(host string) *Breaker {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.breakers == nil {
+		c.breakers = map[string]*Breaker{}
+	}
+
+	b, ok := c.breakers[host]
+
+	if !ok {
+		b = &Breaker{
+			Threshold: c.Threshold,
+			Cooldown:  c.Cooldown,
+		}
+
+		c.breakers[host] = b
+	}
+
+	return b
+}
+
+// Status of the circuit breakers
+func (c *Circuits) Status() map[string]BreakerStatus {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	status := map[string]BreakerStatus{}
+
+	for host, b := range c.breakers {
+		status[host] = b.Status()
+	}
+
+	return status
+}
+
+// Open tells the hosts with an open circuit
+func (c *Circuits) Open() (hosts []string) {
+	for host, s := range c.Status() {
+		if s.State == CircuitOpen {
+			hosts = append(hosts, host)
+		}
+	}
+
+	return hosts
+}
+
+// String returns the status of the circuit breakers as JSON (implementing expvar.Var)
+func (c *Circuits) String() string {
+	res, _ := json.Marshal(c.Status())
+	return string(res)
+}
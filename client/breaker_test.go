@@ -0,0 +1,237 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestBreaker(t *testing.T) {
+	b := &Breaker{
+		Threshold: 2,
+		Cooldown:  20 * time.Millisecond,
+	}
+
+	if !b.Allow() || b.Status().State != CircuitClosed {
+		t.Errorf("New circuit should be closed, got %+v", b.Status())
+	}
+
+	b.Failure()
+
+	if !b.Allow() || b.Status().State != CircuitClosed {
+		t.Errorf("Circuit should be closed before the threshold, got %+v", b.Status())
+	}
+
+	b.Failure()
+
+	if b.Allow() || b.Status().State != CircuitOpen {
+		t.Errorf("Circuit should be open after the threshold, got %+v", b.Status())
+	}
+
+	time.Sleep(30 * time.Millisecond)
+
+	if !b.Allow() || b.Status().State != CircuitHalfOpen {
+		t.Errorf("Circuit should allow a trial request after the cooldown, got %+v", b.Status())
+	}
+
+	if b.Allow() {
+		t.Errorf("Circuit should allow a single trial request")
+	}
+
+	b.Failure()
+
+	if b.Allow() || b.Status().State != CircuitOpen {
+		t.Errorf("Circuit should open again after a failed trial request, got %+v", b.Status())
+	}
+
+	time.Sleep(30 * time.Millisecond)
+	b.Allow()
+	b.Success()
+
+	if !b.Allow() || b.Status().State != CircuitClosed || b.Status().Failures != 0 {
+		t.Errorf("Circuit should be closed after a successful trial request, got %+v", b.Status())
+	}
+}
+
+func TestCircuits(t *testing.T) {
+	c := &Circuits{
+		Threshold: 1,
+		Cooldown:  time.Minute,
+	}
+
+	c.Breaker("example.net").Failure()
+	c.Breaker("example.com").Success()
+
+	if c.Breaker("example.net") != c.Breaker("example.net") {
+		t.Errorf("Breaker() should return the same breaker for the same host")
+	}
+
+	open := c.Open()
+
+	if len(open) != 1 || open[0] != "example.net" {
+		t.Errorf("Open() == %v, want %v", open, []string{"example.net"})
+	}
+
+	if status := c.Status(); status["example.com"].State != CircuitClosed || status["example.net"].OpenedAt == nil {
+		t.Errorf("Status() == %+v is not valid", status)
+	}
+
+	if c.String() == "" {
+		t.Errorf("String() should return the status as JSON")
+	}
+}
+
+func TestLoadCircuitOpen(t *testing.T) {
+	var requests int32
+
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+
+	ts := httptest.NewServer(http.HandlerFunc(handler))
+	defer ts.Close()
+
+	file, tmpFileErr := ioutil.TempFile(os.TempDir(), "picel")
+	defer os.Remove(file.Name())
+
+	if tmpFileErr != nil {
+		panic(tmpFileErr)
+	}
+
+	circuits := &Circuits{
+		Threshold: 2,
+		Cooldown:  time.Minute,
+	}
+
+	for i := 0; i < 2; i++ {
+		var download = &Download{
+			URL:      ts.URL + "/content",
+			Filename: file.Name(),
+			Circuits: circuits,
+		}
+
+		if err := download.Load(); err != ErrBackendUnavailable {
+			t.Errorf("Load() should fail with %v, got %v instead", ErrBackendUnavailable, err)
+		}
+	}
+
+	var download = &Download{
+		URL:      ts.URL + "/content",
+		Filename: file.Name(),
+		Circuits: circuits,
+	}
+
+	if err := download.Load(); err != ErrCircuitOpen {
+		t.Errorf("Load() should fail with %v, got %v instead", ErrCircuitOpen, err)
+	}
+
+	if requests != 2 {
+		t.Errorf("Expected 2 requests, got %v instead", requests)
+	}
+}
+
+func TestBreakerRelease(t *testing.T) {
+	b := &Breaker{
+		Threshold: 1,
+		Cooldown:  20 * time.Millisecond,
+	}
+
+	b.Failure()
+	time.Sleep(30 * time.Millisecond)
+
+	if !b.Allow() || b.Allow() {
+		t.Errorf("Circuit should allow a single trial request after the cooldown")
+	}
+
+	b.Release()
+
+	if !b.Allow() || b.Status().State != CircuitHalfOpen {
+		t.Errorf("Circuit should allow another trial request after releasing the trial, got %+v", b.Status())
+	}
+}
+
+func TestReport(t *testing.T) {
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	expired, cancelExpired := context.WithTimeout(context.Background(), -time.Second)
+	defer cancelExpired()
+
+	newHalfOpen := func() *Breaker {
+		b := &Breaker{
+			Threshold: 1,
+			Cooldown:  time.Nanosecond,
+		}
+
+		b.Failure()
+		time.Sleep(time.Millisecond)
+		b.Allow()
+		return b
+	}
+
+	b := newHalfOpen()
+	report(canceled, b, context.Canceled)
+
+	if !b.Allow() || b.Status().State != CircuitHalfOpen {
+		t.Errorf("Canceled trial request should release the trial, got %+v", b.Status())
+	}
+
+	b = newHalfOpen()
+	report(expired, b, context.DeadlineExceeded)
+
+	if status := b.Status(); status.State != CircuitOpen || status.Failures != 2 {
+		t.Errorf("Timed out trial request should open the circuit again, got %+v", status)
+	}
+
+	b = &Breaker{
+		Threshold: 2,
+		Cooldown:  time.Minute,
+	}
+
+	report(expired, b, context.DeadlineExceeded)
+	report(expired, b, context.DeadlineExceeded)
+
+	if b.Allow() || b.Status().State != CircuitOpen {
+		t.Errorf("Timing out requests should open the circuit, got %+v", b.Status())
+	}
+}
+
+func TestLoadCircuitOpenOnTimeouts(t *testing.T) {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(time.Second):
+		}
+	}
+
+	ts := httptest.NewServer(http.HandlerFunc(handler))
+	defer ts.Close()
+
+	circuits := &Circuits{
+		Threshold: 1,
+		Cooldown:  time.Minute,
+	}
+
+	var download = &Download{
+		URL:      ts.URL + "/content",
+		Buffer:   &bytes.Buffer{},
+		Circuits: circuits,
+	}
+
+	download.Timeout(20 * time.Millisecond)
+
+	if err := download.Load(); err == nil {
+		t.Errorf("Load() should time out")
+	}
+
+	if open := circuits.Open(); len(open) != 1 {
+		t.Errorf("Circuit should be open after timing out, got %v instead", circuits.Status())
+	}
+}
@@ -4,10 +4,13 @@ Package client is the HTTP(S) client for picel.
 package client
 
 import (
+	"bytes"
 	"context"
 	"errors"
+	"fmt"
 	"io"
 	"net/http"
+	"net/url"
 	"os"
 
 	"time"
@@ -23,17 +26,48 @@ var (
 
 	// ErrBackend is a generic error returned when the server fails to fulfill the request
 	ErrBackend = errors.New("Backend server failed to fulfill the request")
+
+	// ErrBackendUnavailable is returned when the server fails with a 5xx status code
+	ErrBackendUnavailable = errors.New("Backend server is temporarily unable to fulfill the request")
 )
 
-// Download a given URL
+// SizeError is returned when the source is larger than the maximum download size
+type SizeError struct {
+	Limit int64
+	Size  int64
+}
+
+func (e *SizeError) Error() string {
+	if e.Size < 0 {
+		return fmt.Sprintf("Source exceeds the maximum download size of %d bytes", e.Limit)
+	}
+
+	return fmt.Sprintf("Source size of %d bytes exceeds the maximum download size of %d bytes", e.Size, e.Limit)
+}
+
+// Download a given URL to the file at Filename, or to Buffer when it is set
+// Context cancels the download when it is done, such as when the client of a request goes away
 type Download struct {
-	URL           string
-	Filename      string
-	file          *os.File
-	request       *http.Request
-	timeout       *time.Duration
-	cancelTimeout *context.CancelFunc
-	context       context.Context
+	URL              string
+	Filename         string
+	Buffer           *bytes.Buffer
+	Signer           Signer
+	Header           http.Header
+	BackendHeaders   map[string]http.Header
+	Fetcher          Fetcher
+	Retry            Retry
+	Circuits         *Circuits
+	Mirrors          []string
+	HedgeAfter       time.Duration
+	MaxSize          int64
+	ContentTypes     map[string]bool
+	ContentTypeCheck string
+	Metadata         Metadata
+	Context          context.Context
+	target           target
+	timeout          *time.Duration
+	cancelTimeout    *context.CancelFunc
+	context          context.Context
 }
 
 // Timeout for the request
@@ -50,64 +84,150 @@ func (d *Download) Cancel() {
 
 // Load the download
 func (d *Download) Load() (err error) {
-	if err = d.createFile(); err != nil {
+	if err = d.createTarget(); err != nil {
 		return err
 	}
 
-	defer d.file.Close()
+	defer d.closeTarget()
 
-	if err = d.setupRequest(); err != nil {
-		return err
-	}
+	d.setupContext()
+	defer d.Cancel()
 
-	d.request.Header.Set("User-Agent", UserAgent)
 	return d.do()
 }
 
-func (d *Download) createFile() (err error) {
-	d.file, err = os.Create(d.Filename)
-	return err
+func (d *Download) fetcher() Fetcher {
+	if d.Fetcher != nil {
+		return d.Fetcher
+	}
+
+	return &HTTP{
+		Signer:         d.Signer,
+		Header:         d.Header,
+		BackendHeaders: d.BackendHeaders,
+	}
+}
+
+func (d *Download) breaker(source string) *Breaker {
+	if d.Circuits == nil || d.Circuits.Threshold == 0 {
+		return nil
+	}
+
+	var host string
+
+	if u, err := url.Parse(source); err == nil {
+		host = u.Host
+	}
+
+	return d.Circuits.Breaker(host)
 }
 
-func (d *Download) setupRequestTimeout() {
+func (d *Download) setupContext() {
+	d.context = d.Context
+
+	if d.context == nil {
+		d.context = context.Background()
+	}
+
 	if d.timeout != nil && *d.timeout != 0*time.Second {
 		var c context.CancelFunc
 		d.context, c = context.WithTimeout(d.context, *d.timeout)
 		d.cancelTimeout = &c
-		d.request = d.request.WithContext(d.context)
 	}
 }
 
-func (d *Download) setupRequest() (err error) {
-	d.request, err = http.NewRequest("GET", d.URL, nil)
+// load a source into a target, retrying on transient failures
+func (d *Download) load(ctx context.Context, source string, t target) (m Metadata, err error) {
+	breaker := d.breaker(source)
 
-	if err != nil {
-		return err
+	for attempt := 1; ; attempt++ {
+		if breaker != nil && !breaker.Allow() {
+			Metrics.Add("circuit_rejected", 1)
+			return m, ErrCircuitOpen
+		}
+
+		m, err = d.try(ctx, source, t)
+		report(ctx, breaker, err)
+
+		if err == nil || attempt > d.Retry.Retries || !IsTemporary(err) {
+			return m, err
+		}
+
+		Metrics.Add("retries", 1)
+
+		if waitErr := d.Retry.wait(ctx, attempt); waitErr != nil {
+			return m, err
+		}
 	}
+}
 
-	d.context = context.Background()
-	d.setupRequestTimeout()
-	d.request = d.request.WithContext(d.context)
-	return nil
+// report the result of a request to the circuit breaker of the backend
+// Timing out counts as a failure, while canceled requests (i.e., losing hedged requests) only release the trial
+func report(ctx context.Context, breaker *Breaker, err error) {
+	switch {
+	case breaker == nil:
+	case err == nil:
+		breaker.Success()
+	case ctx.Err() == context.DeadlineExceeded:
+		breaker.Failure()
+	case ctx.Err() != nil:
+		breaker.Release()
+	case IsTemporary(err):
+		breaker.Failure()
+	default:
+		breaker.Success()
+	}
 }
 
-func (d *Download) do() (err error) {
-	var resp *http.Response
-	resp, err = client.Do(d.request)
+func (d *Download) try(ctx context.Context, source string, t target) (m Metadata, err error) {
+	var body io.ReadCloser
+	body, m, err = d.fetcher().Fetch(ctx, source)
 
 	if err != nil {
-		return err
+		return m, err
+	}
+
+	defer body.Close()
+
+	if err = d.checkContentType(m.ContentType); err != nil {
+		return m, err
+	}
+
+	if d.MaxSize > 0 && m.Size > d.MaxSize {
+		return m, d.rejectSize(m.Size)
 	}
 
-	defer resp.Body.Close()
+	if err = t.rewind(); err != nil {
+		return m, err
+	}
+
+	if d.MaxSize <= 0 {
+		_, err = io.Copy(t, body)
+		return m, err
+	}
+
+	var n int64
+
+	if n, err = io.Copy(t, io.LimitReader(body, d.MaxSize+1)); err == nil && n > d.MaxSize {
+		err = d.rejectSize(-1)
+	}
+
+	return m, err
+}
+
+func (d *Download) rejectSize(size int64) error {
+	Metrics.Add("rejected_size", 1)
+
+	return &SizeError{
+		Limit: d.MaxSize,
+		Size:  size,
+	}
+}
 
-	switch resp.StatusCode {
-	case http.StatusOK:
-		_, err = io.Copy(d.file, resp.Body)
+func rewind(file *os.File) error {
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
 		return err
-	case http.StatusNotFound:
-		return http.ErrMissingFile
 	}
 
-	return ErrBackend
+	return file.Truncate(0)
 }
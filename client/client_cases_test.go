@@ -5,3 +5,11 @@ var LoadCases = []LoadProvider{
 	{"/xyz"},
 	{"/content"},
 }
+
+var LoadMaxSizeCases = []LoadMaxSizeProvider{
+	{"/", 0, 0},
+	{"/", 10, 0},
+	{"/", 9, 10},
+	{"/chunked", 20, 0},
+	{"/chunked", 19, -1},
+}
@@ -1,6 +1,9 @@
 package client
 
 import (
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"net/http"
@@ -14,6 +17,12 @@ type LoadProvider struct {
 	word string
 }
 
+type LoadMaxSizeProvider struct {
+	path string
+	max  int64
+	size int64
+}
+
 func TestLoadWithInvalidFilename(t *testing.T) {
 	var download = &Download{
 		URL: "0/foo.png",
@@ -243,3 +252,71 @@ func TestLoadTimeoutCanceled(t *testing.T) {
 		t.Errorf("Wanted error to be %v, got %v instead", wantErr, err)
 	}
 }
+
+func TestLoadContextCanceled(t *testing.T) {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(time.Second)
+		fmt.Fprintf(w, r.URL.Path)
+	}
+
+	ts := httptest.NewServer(http.HandlerFunc(handler))
+	defer ts.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	var download = &Download{
+		URL:     ts.URL + "/content",
+		Buffer:  &bytes.Buffer{},
+		Context: ctx,
+	}
+
+	download.Timeout(5 * time.Second)
+
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		cancel()
+	}()
+
+	if err := download.Load(); !errors.Is(err, context.Canceled) {
+		t.Errorf("Wanted error to be %v, got %v instead", context.Canceled, err)
+	}
+}
+
+func TestLoadMaxSize(t *testing.T) {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/chunked" {
+			w.Write([]byte("0123456789"))
+			w.(http.Flusher).Flush()
+		}
+
+		fmt.Fprintf(w, "0123456789")
+	}
+
+	ts := httptest.NewServer(http.HandlerFunc(handler))
+	defer ts.Close()
+
+	for _, c := range LoadMaxSizeCases {
+		file, tmpFileErr := ioutil.TempFile(os.TempDir(), "picel")
+		defer os.Remove(file.Name())
+
+		if tmpFileErr != nil {
+			panic(tmpFileErr)
+		}
+
+		var download = &Download{
+			URL:      ts.URL + c.path,
+			Filename: file.Name(),
+			MaxSize:  c.max,
+		}
+
+		err := download.Load()
+		sizeErr, ok := err.(*SizeError)
+
+		switch {
+		case c.size == 0 && err != nil:
+			t.Errorf("Load(%v) with max size %v should not fail, got %v instead", c.path, c.max, err)
+		case c.size != 0 && (!ok || sizeErr.Size != c.size || sizeErr.Limit != c.max):
+			t.Errorf("Load(%v) with max size %v should fail with size %v, got %v instead", c.path, c.max, c.size, err)
+		}
+	}
+}
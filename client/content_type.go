@@ -0,0 +1,65 @@
+package client
+
+import (
+	"fmt"
+	"mime"
+	"strings"
+)
+
+const (
+	// ContentTypeLenient accepts the allowed content types, and missing or generic binary ones
+	ContentTypeLenient = "lenient"
+
+	// ContentTypeStrict only accepts the allowed content types
+	ContentTypeStrict = "strict"
+
+	// ContentTypeOff doesn't check the content type
+	ContentTypeOff = "off"
+)
+
+// GenericContentTypes are accepted by the lenient mode, as some storage servers use them for any file
+var GenericContentTypes = map[string]bool{
+	"":                         true,
+	"application/octet-stream": true,
+	"binary/octet-stream":      true,
+}
+
+// ContentTypeError is returned when the source content type is not allowed
+type ContentTypeError struct {
+	ContentType string
+}
+
+func (e *ContentTypeError) Error() string {
+	if e.ContentType == "" {
+		return "Backend returned no content type"
+	}
+
+	return fmt.Sprintf("Backend returned unsupported content type %v", e.ContentType)
+}
+
+// IsValidContentTypeCheck tells if a content type check mode is valid
+func IsValidContentTypeCheck(mode string) bool {
+	return mode == ContentTypeLenient || mode == ContentTypeStrict || mode == ContentTypeOff
+}
+
+func (d *Download) checkContentType(contentType string) error {
+	if d.ContentTypes == nil || d.ContentTypeCheck == ContentTypeOff {
+		return nil
+	}
+
+	mediaType, _, err := mime.ParseMediaType(contentType)
+
+	if err != nil {
+		mediaType = strings.ToLower(strings.TrimSpace(contentType))
+	}
+
+	if d.ContentTypes[mediaType] || (d.ContentTypeCheck != ContentTypeStrict && GenericContentTypes[mediaType]) {
+		return nil
+	}
+
+	Metrics.Add("rejected_content_type", 1)
+
+	return &ContentTypeError{
+		ContentType: contentType,
+	}
+}
@@ -0,0 +1,16 @@
+package client
+
+var CheckContentTypeCases = []CheckContentTypeProvider{
+	{ContentTypeLenient, "image/jpeg", true},
+	{ContentTypeLenient, "IMAGE/PNG; charset=binary", true},
+	{ContentTypeLenient, "", true},
+	{ContentTypeLenient, "application/octet-stream", true},
+	{ContentTypeLenient, "binary/octet-stream", true},
+	{ContentTypeLenient, "text/html; charset=utf-8", false},
+	{ContentTypeLenient, "image/svg+xml", false},
+	{ContentTypeStrict, "image/jpeg", true},
+	{ContentTypeStrict, "", false},
+	{ContentTypeStrict, "application/octet-stream", false},
+	{ContentTypeStrict, "text/html", false},
+	{ContentTypeOff, "text/html", true},
+}
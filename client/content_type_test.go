@@ -0,0 +1,53 @@
+package client
+
+import "testing"
+
+type CheckContentTypeProvider struct {
+	mode        string
+	contentType string
+	valid       bool
+}
+
+func TestCheckContentType(t *testing.T) {
+	for _, c := range CheckContentTypeCases {
+		d := &Download{
+			ContentTypes: map[string]bool{
+				"image/jpeg": true,
+				"image/png":  true,
+			},
+			ContentTypeCheck: c.mode,
+		}
+
+		err := d.checkContentType(c.contentType)
+
+		if (err == nil) != c.valid {
+			t.Errorf("checkContentType(%q) in %v mode == %v, want valid %v", c.contentType, c.mode, err, c.valid)
+		}
+
+		if cErr, ok := err.(*ContentTypeError); err != nil && (!ok || cErr.ContentType != c.contentType) {
+			t.Errorf("checkContentType(%q) in %v mode should return a ContentTypeError, got %v", c.contentType, c.mode, err)
+		}
+	}
+}
+
+func TestCheckContentTypeWithoutAllowedTypes(t *testing.T) {
+	d := &Download{
+		ContentTypeCheck: ContentTypeStrict,
+	}
+
+	if err := d.checkContentType("text/html"); err != nil {
+		t.Errorf("checkContentType() should not fail when there are no allowed types, got %v instead", err)
+	}
+}
+
+func TestIsValidContentTypeCheck(t *testing.T) {
+	for _, mode := range []string{ContentTypeLenient, ContentTypeStrict, ContentTypeOff} {
+		if !IsValidContentTypeCheck(mode) {
+			t.Errorf("IsValidContentTypeCheck(%v) should be true", mode)
+		}
+	}
+
+	if IsValidContentTypeCheck("") || IsValidContentTypeCheck("other") {
+		t.Errorf("IsValidContentTypeCheck() should be false for unknown modes")
+	}
+}
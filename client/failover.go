@@ -0,0 +1,148 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+type hedgeResult struct {
+	metadata Metadata
+	target   target
+	err      error
+}
+
+func (d *Download) sources() []string {
+	return append([]string{d.URL}, d.Mirrors...)
+}
+
+func shouldFailover(err error) bool {
+	if _, ok := err.(*ContentTypeError); ok {
+		return true
+	}
+
+	return err == http.ErrMissingFile || err == ErrCircuitOpen || IsTemporary(err)
+}
+
+// do the download, trying the mirrors in order when a source is missing or failing
+func (d *Download) do() (err error) {
+	sources := d.sources()
+
+	for i := 0; i < len(sources); {
+		var tried int
+
+		if d.HedgeAfter > 0 && i+1 < len(sources) {
+			d.Metadata, tried, err = d.hedge(sources[i], sources[i+1])
+		} else {
+			d.Metadata, err = d.load(d.context, sources[i], d.target)
+			tried = 1
+		}
+
+		if err == nil || !shouldFailover(err) || d.context.Err() != nil {
+			return err
+		}
+
+		i += tried
+
+		if i < len(sources) {
+			Metrics.Add("failovers", 1)
+		}
+	}
+
+	return err
+}
+
+// hedge loads the primary source, racing it with the secondary if it is slower than HedgeAfter
+// The losing source is canceled and waited for before the winner is kept, so it doesn't write to the download target
+func (d *Download) hedge(primary, secondary string) (m Metadata, tried int, err error) {
+	ctx, cancel := context.WithCancel(d.context)
+	defer cancel()
+
+	primaryTarget, err := d.primaryTarget()
+
+	if err != nil {
+		return m, 0, err
+	}
+
+	results := make(chan hedgeResult, 2)
+	timer := time.NewTimer(d.HedgeAfter)
+	defer timer.Stop()
+
+	go d.race(ctx, primary, primaryTarget, results)
+	tried, pending := 1, 1
+
+	for pending != 0 {
+		select {
+		case <-timer.C:
+			hedgeTarget, targetErr := d.hedgeTarget()
+
+			if targetErr != nil {
+				continue
+			}
+
+			Metrics.Add("hedged", 1)
+			go d.race(ctx, secondary, hedgeTarget, results)
+			tried, pending = 2, pending+1
+		case r := <-results:
+			pending--
+
+			if r.err == nil {
+				cancel()
+				d.discard(results, pending)
+				return r.metadata, tried, d.keep(r.target)
+			}
+
+			if tried == 1 {
+				return r.metadata, tried, r.err
+			}
+
+			err = r.err
+		}
+	}
+
+	return m, tried, err
+}
+
+// primaryTarget is the target of the primary source of a hedged download
+// Buffers get a separate target, as a buffer can't be written by the primary and copied from the secondary at once
+func (d *Download) primaryTarget() (target, error) {
+	if d.Buffer != nil {
+		return d.hedgeTarget()
+	}
+
+	return d.target, nil
+}
+
+func (d *Download) race(ctx context.Context, source string, t target, results chan hedgeResult) {
+	m, err := d.load(ctx, source, t)
+
+	if err != nil && t != d.target {
+		t.close(false)
+	}
+
+	results <- hedgeResult{
+		metadata: m,
+		target:   t,
+		err:      err,
+	}
+}
+
+// discard the results of the losing sources, waiting for them to finish
+func (d *Download) discard(results chan hedgeResult, pending int) {
+	for ; pending != 0; pending-- {
+		r := <-results
+
+		if r.err == nil && r.target != d.target {
+			r.target.close(false)
+		}
+	}
+}
+
+// keep the target of the winning source as the download target
+func (d *Download) keep(t target) error {
+	if t == d.target {
+		return nil
+	}
+
+	return t.close(true)
+}
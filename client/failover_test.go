@@ -0,0 +1,245 @@
+package client
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func newFailoverBackend(status int, delay time.Duration) *httptest.Server {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(delay)
+
+		if status != http.StatusOK {
+			w.WriteHeader(status)
+			return
+		}
+
+		fmt.Fprintf(w, "served by %v", r.Host)
+	}
+
+	return httptest.NewServer(http.HandlerFunc(handler))
+}
+
+func loadWithMirrors(primary string, mirrors []string, hedgeAfter time.Duration) (*Download, string, error) {
+	dir, err := ioutil.TempDir(os.TempDir(), "picel")
+
+	if err != nil {
+		panic(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	var download = &Download{
+		URL:        primary + "/foo.jpg",
+		Filename:   filepath.Join(dir, "download"),
+		HedgeAfter: hedgeAfter,
+	}
+
+	for _, m := range mirrors {
+		download.Mirrors = append(download.Mirrors, m+"/foo.jpg")
+	}
+
+	err = download.Load()
+	content, _ := ioutil.ReadFile(download.Filename)
+
+	if files, _ := ioutil.ReadDir(dir); len(files) > 1 {
+		panic(fmt.Sprintf("Temporary files left behind: %v", files))
+	}
+
+	return download, string(content), err
+}
+
+func TestLoadFailover(t *testing.T) {
+	notFound := newFailoverBackend(http.StatusNotFound, 0)
+	defer notFound.Close()
+
+	failing := newFailoverBackend(http.StatusServiceUnavailable, 0)
+	defer failing.Close()
+
+	ok := newFailoverBackend(http.StatusOK, 0)
+	defer ok.Close()
+
+	download, content, err := loadWithMirrors(notFound.URL, []string{failing.URL, ok.URL}, 0)
+
+	if err != nil {
+		t.Errorf("Load() should not fail, got %v instead", err)
+	}
+
+	if want := "served by " + ok.Listener.Addr().String(); content != want {
+		t.Errorf("Downloaded content is %v, want %v", content, want)
+	}
+
+	if download.Metadata.Source != ok.URL+"/foo.jpg" {
+		t.Errorf("Source should be %v, got %v instead", ok.URL+"/foo.jpg", download.Metadata.Source)
+	}
+}
+
+func TestLoadFailoverAllFailing(t *testing.T) {
+	failing := newFailoverBackend(http.StatusServiceUnavailable, 0)
+	defer failing.Close()
+
+	notFound := newFailoverBackend(http.StatusNotFound, 0)
+	defer notFound.Close()
+
+	if _, _, err := loadWithMirrors(failing.URL, []string{notFound.URL}, 0); err != http.ErrMissingFile {
+		t.Errorf("Load() should fail with %v, got %v instead", http.ErrMissingFile, err)
+	}
+}
+
+func TestLoadFailoverOnServerErrors(t *testing.T) {
+	full := newFailoverBackend(http.StatusInsufficientStorage, 0)
+	defer full.Close()
+
+	ok := newFailoverBackend(http.StatusOK, 0)
+	defer ok.Close()
+
+	_, content, err := loadWithMirrors(full.URL, []string{ok.URL}, 0)
+
+	if err != nil {
+		t.Errorf("Load() should not fail, got %v instead", err)
+	}
+
+	if want := "served by " + ok.Listener.Addr().String(); content != want {
+		t.Errorf("Downloaded content is %v, want %v", content, want)
+	}
+}
+
+func TestLoadNoFailoverForPermanentFailures(t *testing.T) {
+	bad := newFailoverBackend(http.StatusForbidden, 0)
+	defer bad.Close()
+
+	ok := newFailoverBackend(http.StatusOK, 0)
+	defer ok.Close()
+
+	if _, _, err := loadWithMirrors(bad.URL, []string{ok.URL}, 0); err != ErrBackend {
+		t.Errorf("Load() should fail with %v, got %v instead", ErrBackend, err)
+	}
+}
+
+func TestLoadHedged(t *testing.T) {
+	slow := newFailoverBackend(http.StatusOK, 300*time.Millisecond)
+	defer slow.Close()
+
+	fast := newFailoverBackend(http.StatusOK, 0)
+	defer fast.Close()
+
+	download, content, err := loadWithMirrors(slow.URL, []string{fast.URL}, 20*time.Millisecond)
+
+	if err != nil {
+		t.Errorf("Load() should not fail, got %v instead", err)
+	}
+
+	if want := "served by " + fast.Listener.Addr().String(); content != want {
+		t.Errorf("Downloaded content is %v, want %v", content, want)
+	}
+
+	if download.Metadata.Source != fast.URL+"/foo.jpg" {
+		t.Errorf("Source should be %v, got %v instead", fast.URL+"/foo.jpg", download.Metadata.Source)
+	}
+}
+
+func TestLoadHedgedPrimaryFaster(t *testing.T) {
+	primary := newFailoverBackend(http.StatusOK, 0)
+	defer primary.Close()
+
+	secondary := newFailoverBackend(http.StatusOK, 0)
+	defer secondary.Close()
+
+	_, content, err := loadWithMirrors(primary.URL, []string{secondary.URL}, 200*time.Millisecond)
+
+	if err != nil {
+		t.Errorf("Load() should not fail, got %v instead", err)
+	}
+
+	if want := "served by " + primary.Listener.Addr().String(); content != want {
+		t.Errorf("Downloaded content is %v, want %v", content, want)
+	}
+}
+
+func TestLoadHedgedBothFailing(t *testing.T) {
+	slow := newFailoverBackend(http.StatusNotFound, 100*time.Millisecond)
+	defer slow.Close()
+
+	failing := newFailoverBackend(http.StatusServiceUnavailable, 0)
+	defer failing.Close()
+
+	ok := newFailoverBackend(http.StatusOK, 0)
+	defer ok.Close()
+
+	_, content, err := loadWithMirrors(slow.URL, []string{failing.URL, ok.URL}, 20*time.Millisecond)
+
+	if err != nil {
+		t.Errorf("Load() should not fail, got %v instead", err)
+	}
+
+	if want := "served by " + ok.Listener.Addr().String(); content != want {
+		t.Errorf("Downloaded content is %v, want %v", content, want)
+	}
+}
+
+func TestLoadHedgedToBuffer(t *testing.T) {
+	slow := newFailoverBackend(http.StatusOK, 300*time.Millisecond)
+	defer slow.Close()
+
+	fast := newFailoverBackend(http.StatusOK, 0)
+	defer fast.Close()
+
+	var download = &Download{
+		URL:        slow.URL + "/foo.jpg",
+		Buffer:     &bytes.Buffer{},
+		Mirrors:    []string{fast.URL + "/foo.jpg"},
+		HedgeAfter: 20 * time.Millisecond,
+	}
+
+	if err := download.Load(); err != nil {
+		t.Errorf("Load() should not fail, got %v instead", err)
+	}
+
+	if want := "served by " + fast.Listener.Addr().String(); download.Buffer.String() != want {
+		t.Errorf("Downloaded content is %v, want %v", download.Buffer.String(), want)
+	}
+}
+
+func TestLoadHedgedToBufferWhilePrimaryWrites(t *testing.T) {
+	streaming := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for i := 0; i < 20; i++ {
+			fmt.Fprint(w, "primary ")
+			w.(http.Flusher).Flush()
+
+			select {
+			case <-r.Context().Done():
+				return
+			case <-time.After(10 * time.Millisecond):
+			}
+		}
+	}))
+
+	defer streaming.Close()
+
+	fast := newFailoverBackend(http.StatusOK, 0)
+	defer fast.Close()
+
+	var download = &Download{
+		URL:        streaming.URL + "/foo.jpg",
+		Buffer:     &bytes.Buffer{},
+		Mirrors:    []string{fast.URL + "/foo.jpg"},
+		HedgeAfter: 20 * time.Millisecond,
+	}
+
+	if err := download.Load(); err != nil {
+		t.Errorf("Load() should not fail, got %v instead", err)
+	}
+
+	time.Sleep(50 * time.Millisecond)
+
+	if want := "served by " + fast.Listener.Addr().String(); download.Buffer.String() != want {
+		t.Errorf("Downloaded content is %q, want %q", download.Buffer.String(), want)
+	}
+}
@@ -0,0 +1,238 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Metadata of a source
+type Metadata struct {
+	Source       string    `json:"source"`
+	Size         int64     `json:"size"`
+	ContentType  string    `json:"contentType"`
+	ETag         string    `json:"etag"`
+	LastModified time.Time `json:"lastModified"`
+	CacheControl string    `json:"cacheControl,omitempty"`
+	Expires      time.Time `json:"expires"`
+}
+
+// Fetcher loads a source, returning its content and metadata
+// A missing source is returned as http.ErrMissingFile
+type Fetcher interface {
+	Fetch(ctx context.Context, source string) (io.ReadCloser, Metadata, error)
+}
+
+// HTTP fetches sources from HTTP(S) servers
+// Header is sent to all servers, BackendHeaders only to the server with the given host
+type HTTP struct {
+	Client         *http.Client
+	Signer         Signer
+	Header         http.Header
+	BackendHeaders map[string]http.Header
+}
+
+// Fetch a source URL
+func (h *HTTP) Fetch(ctx context.Context, source string) (body io.ReadCloser, m Metadata, err error) {
+	var request *http.Request
+
+	if request, err = h.setupRequest(ctx, source); err != nil {
+		return nil, m, err
+	}
+
+	return h.do(request)
+}
+
+func (h *HTTP) setupRequest(ctx context.Context, source string) (request *http.Request, err error) {
+	request, err = http.NewRequest("GET", source, nil)
+
+	if err != nil {
+		return nil, err
+	}
+
+	request = request.WithContext(ctx)
+	request.Header.Set("User-Agent", UserAgent)
+	setHeader(request.Header, h.Header)
+	setHeader(request.Header, h.BackendHeaders[request.URL.Host])
+
+	if h.Signer != nil {
+		err = h.Signer.Sign(request)
+	}
+
+	return request, err
+}
+
+func (h *HTTP) do(request *http.Request) (body io.ReadCloser, m Metadata, err error) {
+	var resp *http.Response
+	c := h.Client
+
+	if c == nil {
+		c = client
+	}
+
+	if resp, err = c.Do(request); err != nil {
+		return nil, m, err
+	}
+
+	switch {
+	case resp.StatusCode == http.StatusOK:
+		return resp.Body, getHTTPMetadata(resp), nil
+	case resp.StatusCode == http.StatusNotFound:
+		err = http.ErrMissingFile
+	case resp.StatusCode >= http.StatusInternalServerError:
+		err = ErrBackendUnavailable
+	default:
+		err = ErrBackend
+	}
+
+	resp.Body.Close()
+	return nil, m, err
+}
+
+func getHTTPMetadata(resp *http.Response) Metadata {
+	m := Metadata{
+		Source:       resp.Request.URL.String(),
+		Size:         resp.ContentLength,
+		ContentType:  resp.Header.Get("Content-Type"),
+		ETag:         resp.Header.Get("ETag"),
+		CacheControl: resp.Header.Get("Cache-Control"),
+	}
+
+	if lm, err := http.ParseTime(resp.Header.Get("Last-Modified")); err == nil {
+		m.LastModified = lm
+	}
+
+	// invalid dates such as "0" mean already expired
+	if expires := resp.Header.Get("Expires"); expires != "" {
+		m.Expires = time.Unix(0, 0).UTC()
+
+		if e, err := http.ParseTime(expires); err == nil {
+			m.Expires = e
+		}
+	}
+
+	return m
+}
+
+// File fetches sources from a directory
+// The scheme and host of URL sources are ignored
+type File struct {
+	Root string
+}
+
+// Fetch a source file
+func (f *File) Fetch(ctx context.Context, source string) (body io.ReadCloser, m Metadata, err error) {
+	if err = ctx.Err(); err != nil {
+		return nil, m, err
+	}
+
+	if u, uErr := url.Parse(source); uErr == nil && u.Scheme != "" {
+		source = u.Path
+	}
+
+	filename := filepath.Join(f.Root, filepath.FromSlash(path.Clean("/"+source)))
+
+	file, err := os.Open(filename)
+
+	if os.IsNotExist(err) {
+		return nil, m, http.ErrMissingFile
+	}
+
+	if err != nil {
+		return nil, m, err
+	}
+
+	info, err := file.Stat()
+
+	if err == nil && info.IsDir() {
+		err = http.ErrMissingFile
+	}
+
+	if err != nil {
+		file.Close()
+		return nil, m, err
+	}
+
+	m = Metadata{
+		Source:       source,
+		Size:         info.Size(),
+		ContentType:  mime.TypeByExtension(filepath.Ext(filename)),
+		ETag:         fmt.Sprintf(`"%x-%x"`, info.ModTime().UnixNano(), info.Size()),
+		LastModified: info.ModTime(),
+	}
+
+	return file, m, nil
+}
+
+// Memory fetches sources stored in memory
+type Memory struct {
+	mutex   sync.RWMutex
+	objects map[string]memoryObject
+}
+
+type memoryObject struct {
+	content  []byte
+	metadata Metadata
+}
+
+// Put a source in memory
+func (m *Memory) Put(source string, content []byte, contentType string) {
+	m.PutMetadata(source, content, Metadata{
+		ContentType:  contentType,
+		ETag:         `"` + hexSHA256(string(content)) + `"`,
+		LastModified: time.Now().UTC(),
+	})
+}
+
+// PutMetadata puts a source in memory with the given metadata (the source and size are set from the arguments)
+func (m *Memory) PutMetadata(source string, content []byte, metadata Metadata) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if m.objects == nil {
+		m.objects = map[string]memoryObject{}
+	}
+
+	metadata.Source = source
+	metadata.Size = int64(len(content))
+
+	m.objects[source] = memoryObject{
+		content:  content,
+		metadata: metadata,
+	}
+}
+
+// Remove a source from memory
+func (m *Memory) Remove(source string) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	delete(m.objects, source)
+}
+
+// Fetch a source from memory
+func (m *Memory) Fetch(ctx context.Context, source string) (io.ReadCloser, Metadata, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	object, ok := m.objects[source]
+
+	if !ok {
+		return nil, Metadata{}, http.ErrMissingFile
+	}
+
+	return ioutil.NopCloser(bytes.NewReader(object.content)), object.metadata, nil
+}
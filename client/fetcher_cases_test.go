@@ -0,0 +1,12 @@
+package client
+
+import "net/http"
+
+var FileFetchCases = []FileFetchProvider{
+	{"dir/foo.png", "foo", nil},
+	{"/dir/foo.png", "foo", nil},
+	{"http://localhost/dir/foo.png", "foo", nil},
+	{"../../dir/foo.png", "foo", nil},
+	{"dir/not-found.png", "", http.ErrMissingFile},
+	{"dir", "", http.ErrMissingFile},
+}
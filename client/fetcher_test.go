@@ -0,0 +1,200 @@
+package client
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+type FileFetchProvider struct {
+	source  string
+	content string
+	err     error
+}
+
+func TestHTTPFetchMetadata(t *testing.T) {
+	lastModified := time.Date(2016, time.November, 3, 10, 0, 0, 0, time.UTC)
+
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "image/png")
+		w.Header().Set("ETag", `"abc"`)
+		w.Header().Set("Last-Modified", lastModified.Format(http.TimeFormat))
+		w.Header().Set("Cache-Control", "public, max-age=60")
+		w.Header().Set("Expires", "0")
+		w.Write([]byte("content"))
+	}
+
+	ts := httptest.NewServer(http.HandlerFunc(handler))
+	defer ts.Close()
+
+	body, m, err := (&HTTP{}).Fetch(context.Background(), ts.URL+"/foo.png")
+
+	if err != nil {
+		t.Fatalf("Fetch() should not fail, got %v instead", err)
+	}
+
+	defer body.Close()
+
+	want := Metadata{
+		Source:       ts.URL + "/foo.png",
+		Size:         7,
+		ContentType:  "image/png",
+		ETag:         `"abc"`,
+		LastModified: lastModified,
+		CacheControl: "public, max-age=60",
+		Expires:      time.Unix(0, 0).UTC(),
+	}
+
+	if m != want {
+		t.Errorf("Fetch() metadata == %+v, want %+v", m, want)
+	}
+}
+
+func TestFileFetch(t *testing.T) {
+	root, err := ioutil.TempDir(os.TempDir(), "picel")
+
+	if err != nil {
+		panic(err)
+	}
+
+	defer os.RemoveAll(root)
+
+	if err := os.MkdirAll(filepath.Join(root, "dir"), 0700); err != nil {
+		panic(err)
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(root, "dir", "foo.png"), []byte("foo"), 0600); err != nil {
+		panic(err)
+	}
+
+	fetcher := &File{
+		Root: root,
+	}
+
+	for _, c := range FileFetchCases {
+		body, m, err := fetcher.Fetch(context.Background(), c.source)
+
+		if err != c.err {
+			t.Errorf("Fetch(%v) error == %v, want %v", c.source, err, c.err)
+		}
+
+		if err != nil {
+			continue
+		}
+
+		content, _ := ioutil.ReadAll(body)
+		body.Close()
+
+		if string(content) != c.content || m.Size != int64(len(c.content)) || m.ContentType != "image/png" || m.ETag == "" {
+			t.Errorf("Fetch(%v) == %v, %+v, want %v", c.source, string(content), m, c.content)
+		}
+	}
+}
+
+func TestMemoryFetch(t *testing.T) {
+	fetcher := &Memory{}
+	fetcher.Put("http://localhost/foo.png", []byte("foo"), "image/png")
+
+	body, m, err := fetcher.Fetch(context.Background(), "http://localhost/foo.png")
+
+	if err != nil {
+		t.Fatalf("Fetch() should not fail, got %v instead", err)
+	}
+
+	content, _ := ioutil.ReadAll(body)
+	body.Close()
+
+	if string(content) != "foo" || m.Size != 3 || m.ContentType != "image/png" || m.ETag == "" {
+		t.Errorf("Fetch() == %v, %+v, want %v", string(content), m, "foo")
+	}
+
+	fetcher.Remove("http://localhost/foo.png")
+
+	if _, _, err := fetcher.Fetch(context.Background(), "http://localhost/foo.png"); err != http.ErrMissingFile {
+		t.Errorf("Fetch() should fail with %v, got %v instead", http.ErrMissingFile, err)
+	}
+}
+
+func TestMemoryFetchCanceled(t *testing.T) {
+	fetcher := &Memory{}
+	fetcher.Put("foo", []byte("foo"), "")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, _, err := fetcher.Fetch(ctx, "foo"); err != context.Canceled {
+		t.Errorf("Fetch() should fail with %v, got %v instead", context.Canceled, err)
+	}
+}
+
+func TestLoadWithFetcher(t *testing.T) {
+	file, tmpFileErr := ioutil.TempFile(os.TempDir(), "picel")
+	defer os.Remove(file.Name())
+
+	if tmpFileErr != nil {
+		panic(tmpFileErr)
+	}
+
+	fetcher := &Memory{}
+	fetcher.Put("memory/foo.gif", []byte("GIF89a"), "image/gif")
+
+	var download = &Download{
+		URL:      "memory/foo.gif",
+		Filename: file.Name(),
+		Fetcher:  fetcher,
+	}
+
+	if err := download.Load(); err != nil {
+		t.Errorf("Load() should not fail, got %v instead", err)
+	}
+
+	content, _ := ioutil.ReadFile(file.Name())
+
+	if string(content) != "GIF89a" || download.Metadata.ContentType != "image/gif" {
+		t.Errorf("Load() got %v (%+v), want %v", string(content), download.Metadata, "GIF89a")
+	}
+}
+
+func TestHTTPFetchHeaders(t *testing.T) {
+	var got http.Header
+
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header
+	}
+
+	ts := httptest.NewServer(http.HandlerFunc(handler))
+	defer ts.Close()
+
+	fetcher := &HTTP{
+		Header: http.Header{
+			"Cookie":        {"session=foo"},
+			"Authorization": {"Bearer forwarded"},
+		},
+		BackendHeaders: map[string]http.Header{
+			ts.Listener.Addr().String(): {
+				"Authorization": {BasicAuth("user", "pass")},
+			},
+			"example.net": {
+				"X-Api-Key": {"other"},
+			},
+		},
+	}
+
+	body, _, err := fetcher.Fetch(context.Background(), ts.URL+"/foo.png")
+
+	if err != nil {
+		t.Fatalf("Fetch() should not fail, got %v instead", err)
+	}
+
+	body.Close()
+
+	if got.Get("Cookie") != "session=foo" || got.Get("Authorization") != "Basic dXNlcjpwYXNz" ||
+		got.Get("X-Api-Key") != "" || got.Get("User-Agent") != UserAgent {
+		t.Errorf("Headers sent to the backend are not valid: %v", got)
+	}
+}
@@ -0,0 +1,51 @@
+package client
+
+import (
+	"encoding/base64"
+	"net/http"
+	"sort"
+)
+
+// HopByHopHeaders are headers that must not be forwarded to the backend
+var HopByHopHeaders = map[string]bool{
+	"Connection":          true,
+	"Content-Length":      true,
+	"Host":                true,
+	"Keep-Alive":          true,
+	"Proxy-Authenticate":  true,
+	"Proxy-Authorization": true,
+	"Te":                  true,
+	"Trailer":             true,
+	"Transfer-Encoding":   true,
+	"Upgrade":             true,
+}
+
+// BasicAuth returns the Authorization header value for the Basic authentication scheme
+func BasicAuth(username, password string) string {
+	return "Basic " + base64.StdEncoding.EncodeToString([]byte(username+":"+password))
+}
+
+// BearerAuth returns the Authorization header value for the Bearer authentication scheme
+func BearerAuth(token string) string {
+	return "Bearer " + token
+}
+
+// HeaderNames returns the sorted names of the headers, so they can be shown without exposing secret values
+func HeaderNames(h http.Header) (names []string) {
+	for name := range h {
+		names = append(names, http.CanonicalHeaderKey(name))
+	}
+
+	sort.Strings(names)
+	return names
+}
+
+func setHeader(dst http.Header, src http.Header) {
+	for name, values := range src {
+		dst.Del(name)
+
+		for _, v := range values {
+			dst.Add(name, v)
+		}
+	}
+}
@@ -0,0 +1,6 @@
+package client
+
+import "expvar"
+
+// Metrics of the client, published on /debug/vars
+var Metrics = expvar.NewMap("picel.client")
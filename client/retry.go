@@ -0,0 +1,67 @@
+package client
+
+import (
+	"context"
+	"io"
+	"math/rand"
+	"net"
+	"net/url"
+	"time"
+)
+
+// Retry policy for idempotent download failures (5xx responses and network errors)
+// The zero value disables retrying
+type Retry struct {
+	Retries    int
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+}
+
+// Delay before a given retry attempt, using exponential backoff with full jitter
+func (r Retry) Delay(attempt int) time.Duration {
+	if r.Backoff <= 0 {
+		return 0
+	}
+
+	ceil := r.Backoff
+
+	for i := 1; i < attempt && (r.MaxBackoff <= 0 || ceil < r.MaxBackoff); i++ {
+		ceil *= 2
+	}
+
+	if r.MaxBackoff > 0 && ceil > r.MaxBackoff {
+		ceil = r.MaxBackoff
+	}
+
+	return time.Duration(rand.Int63n(int64(ceil) + 1))
+}
+
+func (r Retry) wait(ctx context.Context, attempt int) error {
+	timer := time.NewTimer(r.Delay(attempt))
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// IsTemporary tells if a download error is transient and the download might be retried
+func IsTemporary(err error) bool {
+	if err == ErrBackendUnavailable || err == io.ErrUnexpectedEOF {
+		return true
+	}
+
+	if ue, ok := err.(*url.Error); ok {
+		err = ue.Err
+	}
+
+	if err == context.Canceled || err == context.DeadlineExceeded {
+		return false
+	}
+
+	_, ok := err.(net.Error)
+	return ok
+}
@@ -0,0 +1,30 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+var RetryDelayCases = []RetryDelayProvider{
+	{Retry{}, 1, 0},
+	{Retry{Backoff: 100 * time.Millisecond}, 1, 100 * time.Millisecond},
+	{Retry{Backoff: 100 * time.Millisecond}, 3, 400 * time.Millisecond},
+	{Retry{Backoff: 100 * time.Millisecond, MaxBackoff: 250 * time.Millisecond}, 3, 250 * time.Millisecond},
+	{Retry{Backoff: 100 * time.Millisecond, MaxBackoff: time.Second}, 60, time.Second},
+}
+
+var IsTemporaryCases = []IsTemporaryProvider{
+	{nil, false},
+	{ErrBackend, false},
+	{ErrBackendUnavailable, true},
+	{http.ErrMissingFile, false},
+	{io.ErrUnexpectedEOF, true},
+	{errors.New("other"), false},
+	{context.DeadlineExceeded, false},
+	{temporaryNetError{}, true},
+	{&url.Error{Op: "Get", URL: "http://localhost/", Err: temporaryNetError{}}, true},
+}
@@ -0,0 +1,184 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type RetryDelayProvider struct {
+	retry   Retry
+	attempt int
+	max     time.Duration
+}
+
+type IsTemporaryProvider struct {
+	err       error
+	temporary bool
+}
+
+type temporaryNetError struct{}
+
+func (temporaryNetError) Error() string   { return "connection reset by peer" }
+func (temporaryNetError) Timeout() bool   { return false }
+func (temporaryNetError) Temporary() bool { return true }
+
+func TestRetryDelay(t *testing.T) {
+	for _, c := range RetryDelayCases {
+		for i := 0; i < 20; i++ {
+			if got := c.retry.Delay(c.attempt); got < 0 || got > c.max {
+				t.Errorf("Delay(%v) for %+v == %v, want up to %v", c.attempt, c.retry, got, c.max)
+			}
+		}
+	}
+}
+
+func TestIsTemporary(t *testing.T) {
+	for _, c := range IsTemporaryCases {
+		if got := IsTemporary(c.err); got != c.temporary {
+			t.Errorf("IsTemporary(%v) == %v, want %v", c.err, got, c.temporary)
+		}
+	}
+}
+
+func loadWithRetry(url string, retry Retry, timeout time.Duration) error {
+	file, tmpFileErr := ioutil.TempFile(os.TempDir(), "picel")
+	defer os.Remove(file.Name())
+
+	if tmpFileErr != nil {
+		panic(tmpFileErr)
+	}
+
+	var download = &Download{
+		URL:      url,
+		Filename: file.Name(),
+		Retry:    retry,
+	}
+
+	download.Timeout(timeout)
+
+	return download.Load()
+}
+
+func TestLoadRetry(t *testing.T) {
+	var requests int32
+
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&requests, 1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+
+		fmt.Fprint(w, r.URL.Path)
+	}
+
+	ts := httptest.NewServer(http.HandlerFunc(handler))
+	defer ts.Close()
+
+	retry := Retry{
+		Retries: 2,
+		Backoff: time.Millisecond,
+	}
+
+	if err := loadWithRetry(ts.URL+"/content", retry, time.Second); err != nil {
+		t.Errorf("Load() should not fail, got %v instead", err)
+	}
+
+	if requests != 3 {
+		t.Errorf("Expected 3 requests, got %v instead", requests)
+	}
+}
+
+func TestLoadRetryExhausted(t *testing.T) {
+	var requests int32
+
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.WriteHeader(http.StatusBadGateway)
+	}
+
+	ts := httptest.NewServer(http.HandlerFunc(handler))
+	defer ts.Close()
+
+	retry := Retry{
+		Retries: 2,
+		Backoff: time.Millisecond,
+	}
+
+	if err := loadWithRetry(ts.URL+"/content", retry, time.Second); err != ErrBackendUnavailable {
+		t.Errorf("Load() should fail with %v, got %v instead", ErrBackendUnavailable, err)
+	}
+
+	if requests != 3 {
+		t.Errorf("Expected 3 requests, got %v instead", requests)
+	}
+}
+
+func TestLoadNoRetryForPermanentFailures(t *testing.T) {
+	var requests int32
+
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.WriteHeader(http.StatusNotFound)
+	}
+
+	ts := httptest.NewServer(http.HandlerFunc(handler))
+	defer ts.Close()
+
+	retry := Retry{
+		Retries: 2,
+		Backoff: time.Millisecond,
+	}
+
+	if err := loadWithRetry(ts.URL+"/content", retry, time.Second); err != http.ErrMissingFile {
+		t.Errorf("Load() should fail with %v, got %v instead", http.ErrMissingFile, err)
+	}
+
+	if requests != 1 {
+		t.Errorf("Expected 1 request, got %v instead", requests)
+	}
+}
+
+func TestLoadRetryLimitedByTimeout(t *testing.T) {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+
+	ts := httptest.NewServer(http.HandlerFunc(handler))
+	defer ts.Close()
+
+	retry := Retry{
+		Retries: 100,
+		Backoff: 50 * time.Millisecond,
+	}
+
+	start := time.Now()
+
+	if err := loadWithRetry(ts.URL+"/content", retry, 160*time.Millisecond); err != ErrBackendUnavailable {
+		t.Errorf("Load() should fail with %v, got %v instead", ErrBackendUnavailable, err)
+	}
+
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Retrying should stop when the download times out, took %v", elapsed)
+	}
+}
+
+func TestIsTemporaryForContextErrors(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if IsTemporary(ctx.Err()) {
+		t.Errorf("IsTemporary(%v) should be false", ctx.Err())
+	}
+
+	if IsTemporary(&url.Error{Op: "Get", URL: "http://localhost/", Err: ctx.Err()}) {
+		t.Errorf("IsTemporary(%v) should be false for wrapped errors", ctx.Err())
+	}
+}
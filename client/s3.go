@@ -0,0 +1,266 @@
+package client
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// S3DefaultRegion is the region used when none is given
+	S3DefaultRegion = "us-east-1"
+
+	s3Service      = "s3"
+	s3Algorithm    = "AWS4-HMAC-SHA256"
+	s3DateFormat   = "20060102"
+	s3TimeFormat   = "20060102T150405Z"
+	s3EmptyPayload = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+)
+
+var (
+	// ErrS3MissingBucket is returned when the S3 backend has no bucket
+	ErrS3MissingBucket = errors.New("S3 bucket is required")
+
+	// ErrS3MissingSecret is returned when an access key is given without a secret (or vice versa)
+	ErrS3MissingSecret = errors.New("S3 access key ID and secret access key must be given together")
+)
+
+// Signer signs a request before it is sent to the backend
+type Signer interface {
+	Sign(r *http.Request) error
+}
+
+// S3 is an Amazon S3 (or S3-compatible) object storage backend
+// Requests are signed with AWS Signature Version 4 when credentials are set
+type S3 struct {
+	Bucket          string
+	Region          string
+	Endpoint        string
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+	PathStyle       bool
+}
+
+// LoadEnv fills the empty fields of the S3 backend with the environment variables
+// PICEL_S3_BUCKET and the standard AWS ones
+func (s *S3) LoadEnv() {
+	setFromEnv(&s.Bucket, "PICEL_S3_BUCKET")
+	setFromEnv(&s.Endpoint, "AWS_ENDPOINT_URL_S3")
+	setFromEnv(&s.Endpoint, "AWS_ENDPOINT_URL")
+	setFromEnv(&s.AccessKeyID, "AWS_ACCESS_KEY_ID")
+	setFromEnv(&s.SecretAccessKey, "AWS_SECRET_ACCESS_KEY")
+	setFromEnv(&s.SessionToken, "AWS_SESSION_TOKEN")
+	setFromEnv(&s.Region, "AWS_REGION")
+	setFromEnv(&s.Region, "AWS_DEFAULT_REGION")
+}
+
+func setFromEnv(field *string, key string) {
+	if *field == "" {
+		*field = os.Getenv(key)
+	}
+}
+
+// Validate the S3 backend configuration
+func (s *S3) Validate() error {
+	if s.Bucket == "" {
+		return ErrS3MissingBucket
+	}
+
+	if (s.AccessKeyID == "") != (s.SecretAccessKey == "") {
+		return ErrS3MissingSecret
+	}
+
+	if s.Endpoint != "" {
+		if _, err := url.Parse(s.endpoint()); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *S3) region() string {
+	if s.Region == "" {
+		return S3DefaultRegion
+	}
+
+	return s.Region
+}
+
+func (s *S3) endpoint() string {
+	switch {
+	case s.Endpoint == "":
+	case strings.Index(s.Endpoint, "://") == -1:
+		return "https://" + strings.TrimSuffix(s.Endpoint, "/")
+	default:
+		return strings.TrimSuffix(s.Endpoint, "/")
+	}
+
+	if s.region() == S3DefaultRegion {
+		return "https://s3.amazonaws.com"
+	}
+
+	return "https://s3." + s.region() + ".amazonaws.com"
+}
+
+// BaseURL of the bucket, using either the path-style or the virtual-hosted-style
+func (s *S3) BaseURL() string {
+	endpoint := s.endpoint()
+
+	if s.PathStyle {
+		return endpoint + "/" + s.Bucket
+	}
+
+	schemaEnd := strings.Index(endpoint, "://") + len("://")
+	return endpoint[0:schemaEnd] + s.Bucket + "." + endpoint[schemaEnd:]
+}
+
+// Sign the request with AWS Signature Version 4
+// Anonymous requests are left untouched when no credentials are set
+func (s *S3) Sign(r *http.Request) error {
+	s.sign(r, time.Now().UTC())
+	return nil
+}
+
+func (s *S3) sign(r *http.Request, t time.Time) {
+	if s.AccessKeyID == "" {
+		return
+	}
+
+	amzDate := t.Format(s3TimeFormat)
+	scope := strings.Join([]string{t.Format(s3DateFormat), s.region(), s3Service, "aws4_request"}, "/")
+
+	r.Header.Set("X-Amz-Date", amzDate)
+
+	if r.Header.Get("X-Amz-Content-Sha256") == "" {
+		r.Header.Set("X-Amz-Content-Sha256", s3EmptyPayload)
+	}
+
+	if s.SessionToken != "" {
+		r.Header.Set("X-Amz-Security-Token", s.SessionToken)
+	}
+
+	signedHeaders, canonicalHeaders := s3CanonicalHeaders(r)
+	path := r.URL.Path
+
+	if path == "" {
+		path = "/"
+	}
+
+	canonicalRequest := strings.Join([]string{
+		r.Method,
+		s3URIEncode(path, false),
+		s3CanonicalQuery(r.URL.Query()),
+		canonicalHeaders,
+		signedHeaders,
+		r.Header.Get("X-Amz-Content-Sha256"),
+	}, "\n")
+
+	stringToSign := strings.Join([]string{
+		s3Algorithm,
+		amzDate,
+		scope,
+		hexSHA256(canonicalRequest),
+	}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+s.SecretAccessKey), t.Format(s3DateFormat))
+	key = hmacSHA256(key, s.region())
+	key = hmacSHA256(key, s3Service)
+	key = hmacSHA256(key, "aws4_request")
+
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	r.Header.Set("Authorization", fmt.Sprintf("%s Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s3Algorithm, s.AccessKeyID, scope, signedHeaders, signature))
+}
+
+func isS3SignedHeader(name string) bool {
+	return name == "host" || name == "range" || name == "content-type" || name == "content-md5" ||
+		strings.Index(name, "x-amz-") == 0
+}
+
+func s3CanonicalHeaders(r *http.Request) (signed string, canonical string) {
+	host := r.Host
+
+	if host == "" {
+		host = r.URL.Host
+	}
+
+	values := map[string]string{
+		"host": host,
+	}
+
+	for key, v := range r.Header {
+		name := strings.ToLower(key)
+
+		if isS3SignedHeader(name) {
+			values[name] = strings.TrimSpace(strings.Join(v, ","))
+		}
+	}
+
+	var names []string
+
+	for name := range values {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	for _, name := range names {
+		canonical += name + ":" + values[name] + "\n"
+	}
+
+	return strings.Join(names, ";"), canonical
+}
+
+func s3CanonicalQuery(query url.Values) string {
+	var params []string
+
+	for key, values := range query {
+		for _, value := range values {
+			params = append(params, s3URIEncode(key, true)+"="+s3URIEncode(value, true))
+		}
+	}
+
+	sort.Strings(params)
+
+	return strings.Join(params, "&")
+}
+
+func s3URIEncode(raw string, encodeSlash bool) string {
+	var encoded string
+
+	for _, b := range []byte(raw) {
+		switch {
+		case 'A' <= b && b <= 'Z', 'a' <= b && b <= 'z', '0' <= b && b <= '9',
+			b == '-', b == '_', b == '.', b == '~':
+			encoded += string(b)
+		case b == '/' && !encodeSlash:
+			encoded += "/"
+		default:
+			encoded += fmt.Sprintf("%%%02X", b)
+		}
+	}
+
+	return encoded
+}
+
+func hexSHA256(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, s string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(s))
+	return h.Sum(nil)
+}
@@ -0,0 +1,18 @@
+package client
+
+var S3BaseURLCases = []S3BaseURLProvider{
+	{S3{Bucket: "images"}, "https://images.s3.amazonaws.com"},
+	{S3{Bucket: "images", Region: "us-east-1"}, "https://images.s3.amazonaws.com"},
+	{S3{Bucket: "images", Region: "eu-west-1"}, "https://images.s3.eu-west-1.amazonaws.com"},
+	{S3{Bucket: "images", Region: "eu-west-1", PathStyle: true}, "https://s3.eu-west-1.amazonaws.com/images"},
+	{S3{Bucket: "images", Endpoint: "http://localhost:9000/", PathStyle: true}, "http://localhost:9000/images"},
+	{S3{Bucket: "images", Endpoint: "storage.example.net"}, "https://images.storage.example.net"},
+}
+
+var S3ValidateCases = []S3ValidateProvider{
+	{S3{}, ErrS3MissingBucket},
+	{S3{Bucket: "images"}, nil},
+	{S3{Bucket: "images", AccessKeyID: "key"}, ErrS3MissingSecret},
+	{S3{Bucket: "images", SecretAccessKey: "secret"}, ErrS3MissingSecret},
+	{S3{Bucket: "images", AccessKeyID: "key", SecretAccessKey: "secret"}, nil},
+}
@@ -0,0 +1,118 @@
+package client
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// target of a download, either a file or an in-memory buffer
+type target interface {
+	io.Writer
+
+	// rewind the target before a new attempt
+	rewind() error
+
+	// close a hedge target, moving it to the download target if it is kept or removing it otherwise
+	close(keep bool) error
+}
+
+type fileTarget struct {
+	file     *os.File
+	filename string
+}
+
+func (f *fileTarget) Write(p []byte) (int, error) {
+	return f.file.Write(p)
+}
+
+func (f *fileTarget) rewind() error {
+	return rewind(f.file)
+}
+
+func (f *fileTarget) close(keep bool) error {
+	f.file.Close()
+
+	if keep {
+		return os.Rename(f.file.Name(), f.filename)
+	}
+
+	return os.Remove(f.file.Name())
+}
+
+type bufferTarget struct {
+	buffer *bytes.Buffer
+	dest   *bytes.Buffer
+}
+
+func (b *bufferTarget) Write(p []byte) (int, error) {
+	return b.buffer.Write(p)
+}
+
+func (b *bufferTarget) rewind() error {
+	b.buffer.Reset()
+	return nil
+}
+
+func (b *bufferTarget) close(keep bool) error {
+	if keep {
+		b.dest.Reset()
+		_, err := b.dest.Write(b.buffer.Bytes())
+		return err
+	}
+
+	return nil
+}
+
+func (d *Download) createTarget() error {
+	if d.Buffer != nil {
+		d.target = &bufferTarget{
+			buffer: d.Buffer,
+			dest:   d.Buffer,
+		}
+
+		return nil
+	}
+
+	file, err := os.Create(d.Filename)
+
+	if err != nil {
+		return err
+	}
+
+	d.target = &fileTarget{
+		file:     file,
+		filename: d.Filename,
+	}
+
+	return nil
+}
+
+func (d *Download) closeTarget() {
+	if f, ok := d.target.(*fileTarget); ok {
+		f.file.Close()
+	}
+}
+
+// hedgeTarget creates a separate target for a hedged request
+func (d *Download) hedgeTarget() (target, error) {
+	if d.Buffer != nil {
+		return &bufferTarget{
+			buffer: &bytes.Buffer{},
+			dest:   d.Buffer,
+		}, nil
+	}
+
+	file, err := ioutil.TempFile(filepath.Dir(d.Filename), "picel-hedge")
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &fileTarget{
+		file:     file,
+		filename: d.Filename,
+	}, nil
+}
@@ -0,0 +1,242 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/henvic/picel/image"
+	"github.com/henvic/picel/server"
+)
+
+var (
+	// ErrMissingPath is returned when a command requires an image path
+	ErrMissingPath = errors.New("Missing path")
+
+	// ErrInvalidCrop is returned when the crop flag is not in the <x>x<y>:<width>x<height> format
+	ErrInvalidCrop = errors.New("Crop must be in the <x>x<y>:<width>x<height> format")
+
+	// ErrNegativeDimension is returned when the width or the height is negative
+	ErrNegativeDimension = errors.New("Width and height must be non-negative")
+)
+
+// command of picel, returning the exit status
+type command func(args []string, stdin io.Reader, stdout io.Writer, stderr io.Writer) int
+
+func newCommandFlagSet(name, usage string, stderr io.Writer) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		fmt.Fprintf(stderr, "Usage: picel %v %v\n", name, usage)
+		fs.PrintDefaults()
+	}
+
+	return fs
+}
+
+func parseCrop(c string) (crop image.Crop, err error) {
+	if c == "" {
+		return crop, nil
+	}
+
+	if _, err = fmt.Sscanf(c, "%dx%d:%dx%d", &crop.X, &crop.Y, &crop.Width, &crop.Height); err != nil {
+		return crop, ErrInvalidCrop
+	}
+
+	return crop, nil
+}
+
+// encodeTransform returns the request path of a transformation of an image on the backend (optional)
+func encodeTransform(backend string, t image.Transform) string {
+	_, fullname := t.Image.Name()
+	t.Image.Source = fullname
+
+	if backend != "" {
+		t.Image.Source = strings.TrimSuffix(backend, "/") + "/" + fullname
+	}
+
+	return "/" + server.Encode(t)
+}
+
+// validateTransform decodes the encoded transformation, as the server would
+func validateTransform(t image.Transform) error {
+	if t.Width < 0 || t.Height < 0 {
+		return ErrNegativeDimension
+	}
+
+	if t.DPR != 0 && !image.ValidDPR(t.DPR) {
+		return image.ErrInvalidDPR
+	}
+
+	_, _, err := image.Decode(image.Encode(t), image.DefaultInputExtension)
+	return err
+}
+
+func readJSONInput(filename string, stdin io.Reader) (io.ReadCloser, error) {
+	if filename == "-" {
+		return ioutil.NopCloser(stdin), nil
+	}
+
+	return os.Open(filename)
+}
+
+func encodeCommand(args []string, stdin io.Reader, stdout io.Writer, stderr io.Writer) int {
+	var (
+		jsonFile string
+		backend  string
+		path     string
+		crop     string
+		t        image.Transform
+	)
+
+	fs := newCommandFlagSet("encode", "[flags]", stderr)
+	fs.StringVar(&jsonFile, "json", "", "JSON file with the image on the request body format (- for stdin)")
+	fs.StringVar(&backend, "backend", "", "Backend server of the image, such as example.net or https://example.net")
+	fs.StringVar(&path, "path", "", "Path of the image on the backend, such as foo/bar.jpg")
+	fs.BoolVar(&t.Raw, "raw", false, "Serve the original image")
+	fs.StringVar(&crop, "crop", "", "Crop as <x>x<y>:<width>x<height>")
+	fs.IntVar(&t.Width, "width", 0, "Width")
+	fs.IntVar(&t.Height, "height", 0, "Height")
+	fs.Float64Var(&t.DPR, "dpr", 0, "Device pixel ratio multiplying the dimensions")
+	fs.StringVar(&t.Output, "output", "", "Output format (default: the input format)")
+
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	var reqPath string
+	var err error
+
+	switch {
+	case jsonFile != "":
+		var body io.ReadCloser
+
+		if body, err = readJSONInput(jsonFile, stdin); err == nil {
+			reqPath, err = server.EncodeRequest(body)
+			body.Close()
+		}
+	case path == "":
+		err = ErrMissingPath
+	default:
+		t.Image.ID, t.Image.Extension = image.GetFilePathParts(path)
+
+		if t.Crop, err = parseCrop(crop); err == nil {
+			err = validateTransform(t)
+		}
+
+		reqPath = encodeTransform(backend, t)
+	}
+
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+
+	fmt.Fprintln(stdout, reqPath)
+	return 0
+}
+
+func decodeCommand(args []string, stdin io.Reader, stdout io.Writer, stderr io.Writer) int {
+	var (
+		backend       string
+		defaultOutput string
+	)
+
+	fs := newCommandFlagSet("decode", "[flags] <path>...", stderr)
+	fs.StringVar(&backend, "backend", "", "Single backend server (the paths don't have the backend)")
+	fs.StringVar(&defaultOutput, "default-output", image.DefaultInputExtension, "Output format when the path has none")
+
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return 2
+	}
+
+	status := 0
+
+	for _, path := range fs.Args() {
+		path = strings.SplitN(path, "?", 2)[0]
+		e, err := server.ExplainPath(server.Options{Backend: backend}, path, defaultOutput)
+		res, _ := json.MarshalIndent(e, "", "    ")
+		fmt.Fprintln(stdout, string(res))
+
+		if err != nil {
+			status = 1
+		}
+	}
+
+	return status
+}
+
+// processFile processes the input file to the output file with the transformation on the path (without the backend)
+func processFile(path, input, output string) error {
+	defaultOutput := strings.TrimPrefix(filepath.Ext(output), ".")
+
+	if defaultOutput == "" {
+		defaultOutput = image.DefaultInputExtension
+	}
+
+	t, _, err := image.Decode(strings.TrimPrefix(path, "/"), defaultOutput)
+
+	if err != nil {
+		return err
+	}
+
+	if t.Raw {
+		content, err := ioutil.ReadFile(input)
+
+		if err != nil {
+			return err
+		}
+
+		return ioutil.WriteFile(output, content, 0644)
+	}
+
+	p := &image.Processor{
+		Verbose: verbose,
+	}
+
+	return p.Process(t, input, output)
+}
+
+func processCommand(args []string, stdin io.Reader, stdout io.Writer, stderr io.Writer) int {
+	var (
+		input  string
+		output string
+	)
+
+	fs := newCommandFlagSet("process", "--in <file> --out <file> <path>", stderr)
+	fs.StringVar(&input, "in", "", "Input image file")
+	fs.StringVar(&output, "out", "", "Output image file")
+
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	if input == "" || output == "" || fs.NArg() != 1 {
+		fs.Usage()
+		return 2
+	}
+
+	err := image.Init()
+
+	if err == nil {
+		err = processFile(fs.Arg(0), input, output)
+	}
+
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+
+	return 0
+}
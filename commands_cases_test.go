@@ -0,0 +1,29 @@
+package main
+
+var EncodeCommandCases = []EncodeCommandProvider{
+	{[]string{"--path", "foo/bar.png", "--width", "400", "--dpr", "2", "--output", "webp", "--backend", "https://example.net"}, "",
+		"/s:example.net/foo/bar_400x_@2x_png.webp\n", 0},
+	{[]string{"--path", "foo.jpg", "--crop", "1x2:30x40", "--width", "10"}, "", "/foo_1x2:30x40_10x\n", 0},
+	{[]string{"--path", "foo.jpg", "--raw", "--backend", "example.net"}, "", "/example.net/foo_raw.jpg\n", 0},
+	{[]string{"--path", "foo.gif", "--height", "10", "--output", "webp"}, "", "/foo_x10_gif.webp\n", 0},
+	{[]string{"--json", "-"}, `{"backend": "example.net", "path": "a.jpg", "width": 300, "output": "webp"}`,
+		"/example.net/a_300x_jpg.webp\n", 0},
+	{[]string{"--json", "-"}, `{"backend": "example.net", "path": "foo.jpg", "width": 400, "dpr": 1.5}`,
+		"/example.net/foo_400x_@1.5x.jpg\n", 0},
+	{[]string{"--path", "foo.png", "--width", "400", "--dpr", "1.5"}, "", "/foo_400x_@1.5x.png\n", 0},
+	{[]string{"--json", "-"}, `{"width": 300}`, "", 1},
+	{[]string{"--path", "foo.jpg", "--crop", "1x2"}, "", "", 1},
+	{[]string{"--path", "foo.jpg", "--dpr", "9"}, "", "", 1},
+	{[]string{"--path", "foo.jpg", "--dpr", "NaN"}, "", "", 1},
+	{[]string{"--path", "foo.jpg", "--dpr", "Inf"}, "", "", 1},
+	{[]string{"--path", "foo.jpg", "--width", "-3"}, "", "", 1},
+	{[]string{"--width", "300"}, "", "", 1},
+	{[]string{"--unknown"}, "", "", 2},
+}
+
+var DecodeCommandCases = []DecodeCommandProvider{
+	{[]string{"/s:example.net/foo_400x_@2x_png.webp?explain"}, "https://example.net/foo.png", 400, 0},
+	{[]string{"--backend", "example.net", "foo_x300.webp"}, "http://example.net/foo.webp", 0, 0},
+	{[]string{"--backend", "example.net", "/foo_@9x.png"}, "http://example.net/foo", 0, 1},
+	{[]string{"/example.net/foo_400x_@1.5x.jpg"}, "http://example.net/foo.jpg", 400, 0},
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/henvic/picel/server"
+)
+
+type EncodeCommandProvider struct {
+	args   []string
+	stdin  string
+	out    string
+	status int
+}
+
+type DecodeCommandProvider struct {
+	args   []string
+	source string
+	width  int
+	status int
+}
+
+func TestEncodeCommand(t *testing.T) {
+	t.Parallel()
+	for _, c := range EncodeCommandCases {
+		var stdout, stderr bytes.Buffer
+		status := encodeCommand(c.args, strings.NewReader(c.stdin), &stdout, &stderr)
+
+		if status != c.status || stdout.String() != c.out {
+			t.Errorf("encode %v returned %v with %q (stderr: %q), want %v with %q",
+				c.args, status, stdout.String(), stderr.String(), c.status, c.out)
+		}
+	}
+}
+
+func TestDecodeCommand(t *testing.T) {
+	t.Parallel()
+	for _, c := range DecodeCommandCases {
+		var stdout, stderr bytes.Buffer
+		status := decodeCommand(c.args, nil, &stdout, &stderr)
+
+		var e server.Explain
+
+		if err := json.Unmarshal(stdout.Bytes(), &e); err != nil {
+			t.Errorf("decode %v output is not valid JSON: %v", c.args, err)
+		}
+
+		if status != c.status || e.Transform.Image.Source != c.source || e.Transform.Width != c.width {
+			t.Errorf("decode %v returned %v with %+v, want %v with source %v and width %v",
+				c.args, status, e.Transform, c.status, c.source, c.width)
+		}
+	}
+}
+
+func TestDecodeCommandMissingPath(t *testing.T) {
+	t.Parallel()
+	var stdout, stderr bytes.Buffer
+
+	if status := decodeCommand(nil, nil, &stdout, &stderr); status != 2 || !strings.Contains(stderr.String(), "Usage: picel decode") {
+		t.Errorf("decode without paths returned %v with %q, want usage error", status, stderr.String())
+	}
+}
+
+func TestProcessCommandRaw(t *testing.T) {
+	t.Parallel()
+	dir, err := ioutil.TempDir("", "picel-process")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	in := filepath.Join(dir, "in.png")
+	out := filepath.Join(dir, "out.png")
+
+	if err = ioutil.WriteFile(in, testImage("png"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var stdout, stderr bytes.Buffer
+
+	if status := processCommand([]string{"--in", in, "--out", out, "/foo_raw.png"}, nil, &stdout, &stderr); status != 0 {
+		t.Errorf("process raw returned %v (stderr: %q), want 0", status, stderr.String())
+	}
+
+	if content, err := ioutil.ReadFile(out); err != nil || !bytes.Equal(content, testImage("png")) {
+		t.Errorf("process raw should copy the input file, got %v instead", err)
+	}
+}
+
+func TestProcessCommandFailure(t *testing.T) {
+	t.Parallel()
+	var stdout, stderr bytes.Buffer
+
+	if status := processCommand([]string{"--in", "in.png", "/foo_400x.webp"}, nil, &stdout, &stderr); status != 2 {
+		t.Errorf("process without --out returned %v, want 2", status)
+	}
+
+	if status := processCommand([]string{"--in", "not-found.png", "--out", "out.webp", "/foo_400x.webp"}, nil, &stdout, &stderr); status != 1 {
+		t.Errorf("process with a missing input file returned %v, want 1", status)
+	}
+
+	if status := processCommand([]string{"--in", "in.png", "--out", "out.webp", "/foo_@9x.webp"}, nil, &stdout, &stderr); status != 1 {
+		t.Errorf("process with an invalid path returned %v, want 1", status)
+	}
+}
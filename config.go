@@ -0,0 +1,269 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+// configEnvPrefix is the prefix of the environment variables overriding the configuration
+const configEnvPrefix = "PICEL_"
+
+var configFile string
+
+// reloadableFlags are the flags reloaded from the configuration on SIGHUP
+var reloadableFlags = map[string]bool{
+	"backend":                      true,
+	"mirror":                       true,
+	"hedge-after":                  true,
+	"forward-header":               true,
+	"backend-header":               true,
+	"backend-basic-auth":           true,
+	"backend-bearer-token":         true,
+	"max-download-size":            true,
+	"max-upload-size":              true,
+	"downloadTimeout":              true,
+	"content-type-check":           true,
+	"retries":                      true,
+	"retry-backoff":                true,
+	"retry-max-backoff":            true,
+	"client-hints":                 true,
+	"uploads":                      true,
+	"cache-max-age":                true,
+	"cache-stale-while-revalidate": true,
+	"cache-immutable":              true,
+	"origin-cache":                 true,
+	"error-cache-max-age":          true,
+}
+
+// resettable flags are cleared before reloading the configuration, instead of set to their default value
+type resettable interface {
+	reset()
+}
+
+// envName of the environment variable overriding a flag, such as PICEL_MAX_DOWNLOAD_SIZE
+func envName(name string) string {
+	return configEnvPrefix + strings.ToUpper(strings.Replace(name, "-", "_", -1))
+}
+
+func configValue(v interface{}) (string, error) {
+	switch value := v.(type) {
+	case string:
+		return value, nil
+	case json.Number:
+		return value.String(), nil
+	case bool:
+		return strconv.FormatBool(value), nil
+	}
+
+	return "", fmt.Errorf("unsupported value %v", v)
+}
+
+// readConfigFile returns the values of the flags on a JSON configuration file
+// Lists are used for the repeatable flags
+func readConfigFile(filename string) (map[string][]string, error) {
+	content, err := ioutil.ReadFile(filename)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var raw map[string]interface{}
+	decoder := json.NewDecoder(bytes.NewReader(content))
+	decoder.UseNumber()
+
+	if err = decoder.Decode(&raw); err != nil {
+		return nil, fmt.Errorf("invalid configuration file %v: %v", filename, err)
+	}
+
+	values := map[string][]string{}
+
+	for name, v := range raw {
+		list, ok := v.([]interface{})
+
+		if !ok {
+			list = []interface{}{v}
+		}
+
+		for _, item := range list {
+			value, err := configValue(item)
+
+			if err != nil {
+				return nil, fmt.Errorf("invalid %v on %v: %v", name, filename, err)
+			}
+
+			values[name] = append(values[name], value)
+		}
+	}
+
+	return values, nil
+}
+
+// configValues returns the values of the flags on the configuration file, overridden by the environment variables
+func configValues(fs *flag.FlagSet, filename string, environ []string) (map[string][]string, error) {
+	values := map[string][]string{}
+
+	if filename != "" {
+		var err error
+
+		if values, err = readConfigFile(filename); err != nil {
+			return nil, err
+		}
+	}
+
+	for name := range values {
+		if fs.Lookup(name) == nil || name == "config" {
+			return nil, fmt.Errorf("unknown option %v on %v", name, filename)
+		}
+	}
+
+	env := map[string]string{}
+
+	for _, kv := range environ {
+		if parts := strings.SplitN(kv, "=", 2); len(parts) == 2 {
+			env[parts[0]] = parts[1]
+		}
+	}
+
+	fs.VisitAll(func(f *flag.Flag) {
+		if v, ok := env[envName(f.Name)]; ok && f.Name != "config" {
+			values[f.Name] = []string{v}
+		}
+	})
+
+	return values, nil
+}
+
+// recordingFlag records the values of a flag
+type recordingFlag struct {
+	name   string
+	values map[string][]string
+	bool   bool
+}
+
+func (r *recordingFlag) String() string {
+	return ""
+}
+
+func (r *recordingFlag) Set(value string) error {
+	r.values[r.name] = append(r.values[r.name], value)
+	return nil
+}
+
+func (r *recordingFlag) IsBoolFlag() bool {
+	return r.bool
+}
+
+// recordCommandLine returns the values of the flags given on the command line
+func recordCommandLine(fs *flag.FlagSet, args []string) map[string][]string {
+	values := map[string][]string{}
+	recorder := flag.NewFlagSet("", flag.ContinueOnError)
+	recorder.SetOutput(ioutil.Discard)
+
+	fs.VisitAll(func(f *flag.Flag) {
+		b, ok := f.Value.(interface {
+			IsBoolFlag() bool
+		})
+
+		recorder.Var(&recordingFlag{
+			name:   f.Name,
+			values: values,
+			bool:   ok && b.IsBoolFlag(),
+		}, f.Name, "")
+	})
+
+	recorder.Parse(args)
+	return values
+}
+
+// applyConfig sets the flags accepted by filter (all flags if nil) to the given values, skipping the ones given on the command line
+func applyConfig(fs *flag.FlagSet, values map[string][]string, commandLine map[string][]string, filter map[string]bool) error {
+	var names []string
+
+	for name := range values {
+		if _, given := commandLine[name]; !given && (filter == nil || filter[name]) {
+			names = append(names, name)
+		}
+	}
+
+	sort.Strings(names)
+
+	for _, name := range names {
+		for _, v := range values[name] {
+			if err := fs.Set(name, v); err != nil {
+				return fmt.Errorf("invalid value %q for %v: %v", v, name, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// resetFlags sets the given flags to their default values
+func resetFlags(fs *flag.FlagSet, names map[string]bool) {
+	fs.VisitAll(func(f *flag.Flag) {
+		if !names[f.Name] {
+			return
+		}
+
+		if r, ok := f.Value.(resettable); ok {
+			r.reset()
+			return
+		}
+
+		fs.Set(f.Name, f.DefValue)
+	})
+}
+
+// loadConfig applies the configuration file and the environment variables to the flags not given on the command line
+func loadConfig(fs *flag.FlagSet, filename string, environ []string, commandLine map[string][]string) error {
+	values, err := configValues(fs, filename, environ)
+
+	if err != nil {
+		return err
+	}
+
+	return applyConfig(fs, values, commandLine, nil)
+}
+
+// reloadConfig reloads the reloadable flags from the configuration file and the environment
+// The values given on the command line are kept
+func reloadConfig(fs *flag.FlagSet, filename string, environ []string, commandLine map[string][]string) error {
+	values, err := configValues(fs, filename, environ)
+
+	if err != nil {
+		return err
+	}
+
+	resetFlags(fs, reloadableFlags)
+
+	if err = applyConfig(fs, values, commandLine, reloadableFlags); err != nil {
+		return err
+	}
+
+	return applyConfig(fs, commandLine, nil, reloadableFlags)
+}
+
+// reloadableHandler serves with the latest handler stored, so it can be replaced without dropping connections
+type reloadableHandler struct {
+	handler atomic.Value
+}
+
+type storedHandler struct {
+	http.Handler
+}
+
+func (r *reloadableHandler) Store(h http.Handler) {
+	r.handler.Store(storedHandler{h})
+}
+
+func (r *reloadableHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	r.handler.Load().(storedHandler).ServeHTTP(w, req)
+}
@@ -0,0 +1,78 @@
+package main
+
+var ReadConfigFileCases = []ReadConfigFileProvider{
+	{`{}`, map[string][]string{}},
+	{`{"backend": "example.net", "retries": 3, "uploads": true}`, map[string][]string{
+		"backend": {"example.net"},
+		"retries": {"3"},
+		"uploads": {"true"},
+	}},
+	{`{"forward-header": ["Accept-Language", "Cookie"], "max-upload-size": "20MB"}`, map[string][]string{
+		"forward-header":  {"Accept-Language", "Cookie"},
+		"max-upload-size": {"20MB"},
+	}},
+}
+
+var ReadConfigFileFailureCases = []ReadConfigFileFailureProvider{
+	{``},
+	{`[]`},
+	{`{"backend": `},
+	{`{"mirror": {"example.net": "mirror.example.net"}}`},
+	{`{"forward-header": [["Cookie"]]}`},
+	{`{"backend": null}`},
+}
+
+var LoadConfigCases = []LoadConfigProvider{
+	{nil, ``, nil, testFlags{
+		backend: "default.example.net",
+		retries: 2,
+		size:    32 << 20,
+		mirrors: mirrorsFlag{},
+		headers: backendHeadersFlag{},
+		addr:    ":8123",
+	}},
+	{nil, `{"backend": "example.net", "retries": 3, "uploads": true, "forward-header": ["Accept-Language", "Cookie"]}`, nil, testFlags{
+		backend: "example.net",
+		retries: 3,
+		uploads: true,
+		size:    32 << 20,
+		forward: listFlag{"Accept-Language", "Cookie"},
+		mirrors: mirrorsFlag{},
+		headers: backendHeadersFlag{},
+		addr:    ":8123",
+	}},
+	{nil, `{"backend": "example.net", "retries": 3}`, []string{"PICEL_RETRIES=5", "PICEL_MAX_UPLOAD_SIZE=1KB", "OTHER=1"}, testFlags{
+		backend: "example.net",
+		retries: 5,
+		size:    1 << 10,
+		mirrors: mirrorsFlag{},
+		headers: backendHeadersFlag{},
+		addr:    ":8123",
+	}},
+	{[]string{"-backend", "cli.example.net", "-forward-header", "Cookie", "-uploads"}, `{"backend": "example.net", "forward-header": "Accept-Language", "uploads": false}`, []string{"PICEL_BACKEND=env.example.net"}, testFlags{
+		backend: "cli.example.net",
+		retries: 2,
+		uploads: true,
+		size:    32 << 20,
+		forward: listFlag{"Cookie"},
+		mirrors: mirrorsFlag{},
+		headers: backendHeadersFlag{},
+		addr:    ":8123",
+	}},
+	{nil, `{"mirror": ["example.net=m1.example.net", "example.net=m2.example.net"], "backend-header": "example.net=X-Key: secret"}`, nil, testFlags{
+		backend: "default.example.net",
+		retries: 2,
+		size:    32 << 20,
+		mirrors: mirrorsFlag{"example.net": {"m1.example.net", "m2.example.net"}},
+		headers: backendHeadersFlag{"example.net": {"X-Key": {"secret"}}},
+		addr:    ":8123",
+	}},
+}
+
+var LoadConfigFailureCases = []LoadConfigFailureProvider{
+	{`{"unknown": "value"}`, nil},
+	{`{"config": "other.json"}`, nil},
+	{`{"retries": "many"}`, nil},
+	{`{"mirror": "invalid"}`, nil},
+	{`{}`, []string{"PICEL_RETRIES=many"}},
+}
@@ -0,0 +1,299 @@
+package main
+
+import (
+	"flag"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+type ReadConfigFileProvider struct {
+	content string
+	want    map[string][]string
+}
+
+type ReadConfigFileFailureProvider struct {
+	content string
+}
+
+type testFlags struct {
+	backend string
+	retries int
+	uploads bool
+	size    int64
+	forward listFlag
+	mirrors mirrorsFlag
+	headers backendHeadersFlag
+	addr    string
+}
+
+type LoadConfigProvider struct {
+	args    []string
+	config  string
+	environ []string
+	want    testFlags
+}
+
+type LoadConfigFailureProvider struct {
+	config  string
+	environ []string
+}
+
+// newTestFlagSet defines a subset of the picel flags on a new flag set
+func newTestFlagSet() (*flag.FlagSet, *testFlags) {
+	f := &testFlags{
+		size:    32 << 20,
+		mirrors: mirrorsFlag{},
+		headers: backendHeadersFlag{},
+	}
+
+	fs := flag.NewFlagSet("picel", flag.ContinueOnError)
+	fs.SetOutput(ioutil.Discard)
+	fs.StringVar(&configFile, "config", "", "")
+	fs.StringVar(&f.backend, "backend", "default.example.net", "")
+	fs.IntVar(&f.retries, "retries", 2, "")
+	fs.BoolVar(&f.uploads, "uploads", false, "")
+	fs.Var((*byteSizeFlag)(&f.size), "max-upload-size", "")
+	fs.Var(&f.forward, "forward-header", "")
+	fs.Var(f.mirrors, "mirror", "")
+	fs.Var(f.headers.kind("header"), "backend-header", "")
+	fs.StringVar(&f.addr, "addr", ":8123", "")
+	return fs, f
+}
+
+func writeConfigFile(t *testing.T, dir string, content string) string {
+	filename := filepath.Join(dir, "picel.json")
+
+	if err := ioutil.WriteFile(filename, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	return filename
+}
+
+func loadTestConfig(t *testing.T, args []string, filename string, environ []string) (*flag.FlagSet, *testFlags, map[string][]string, error) {
+	fs, f := newTestFlagSet()
+
+	if err := fs.Parse(args); err != nil {
+		t.Fatal(err)
+	}
+
+	commandLine := recordCommandLine(fs, args)
+	return fs, f, commandLine, loadConfig(fs, filename, environ, commandLine)
+}
+
+func TestReadConfigFile(t *testing.T) {
+	t.Parallel()
+	dir, err := ioutil.TempDir("", "picel")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	for _, c := range ReadConfigFileCases {
+		filename := filepath.Join(dir, "picel.json")
+
+		if err := ioutil.WriteFile(filename, []byte(c.content), 0600); err != nil {
+			t.Fatal(err)
+		}
+
+		got, err := readConfigFile(filename)
+
+		if err != nil || !reflect.DeepEqual(got, c.want) {
+			t.Errorf("readConfigFile(%v) == %v, %v, want %v, nil", c.content, got, err, c.want)
+		}
+	}
+}
+
+func TestReadConfigFileFailure(t *testing.T) {
+	t.Parallel()
+	dir, err := ioutil.TempDir("", "picel")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	for _, c := range ReadConfigFileFailureCases {
+		filename := filepath.Join(dir, "picel.json")
+
+		if err := ioutil.WriteFile(filename, []byte(c.content), 0600); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := readConfigFile(filename); err == nil {
+			t.Errorf("readConfigFile(%v) should fail", c.content)
+		}
+	}
+
+	if _, err := readConfigFile(filepath.Join(dir, "missing.json")); err == nil {
+		t.Errorf("readConfigFile() should fail for missing files")
+	}
+}
+
+func TestRecordCommandLine(t *testing.T) {
+	t.Parallel()
+	fs, _ := newTestFlagSet()
+	got := recordCommandLine(fs, []string{"-uploads", "-backend", "example.net", "-forward-header", "A", "--forward-header=B", "extra"})
+
+	want := map[string][]string{
+		"uploads":        {"true"},
+		"backend":        {"example.net"},
+		"forward-header": {"A", "B"},
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("recordCommandLine() == %v, want %v", got, want)
+	}
+}
+
+func TestLoadConfig(t *testing.T) {
+	// don't run in parallel due to mocking configFile
+	defaultConfigFile := configFile
+
+	defer func() {
+		configFile = defaultConfigFile
+	}()
+
+	dir, err := ioutil.TempDir("", "picel")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	for _, c := range LoadConfigCases {
+		var filename string
+
+		if c.config != "" {
+			filename = writeConfigFile(t, dir, c.config)
+		}
+
+		_, f, _, err := loadTestConfig(t, c.args, filename, c.environ)
+
+		if err != nil || !reflect.DeepEqual(*f, c.want) {
+			t.Errorf("loadConfig(%v, %v, %v) == %+v, %v, want %+v, nil", c.args, c.config, c.environ, *f, err, c.want)
+		}
+	}
+}
+
+func TestLoadConfigFailure(t *testing.T) {
+	// don't run in parallel due to mocking configFile
+	defaultConfigFile := configFile
+
+	defer func() {
+		configFile = defaultConfigFile
+	}()
+
+	dir, err := ioutil.TempDir("", "picel")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	for _, c := range LoadConfigFailureCases {
+		filename := writeConfigFile(t, dir, c.config)
+
+		if _, _, _, err := loadTestConfig(t, nil, filename, c.environ); err == nil {
+			t.Errorf("loadConfig(%v, %v) should fail", c.config, c.environ)
+		}
+	}
+}
+
+func TestReloadConfig(t *testing.T) {
+	// don't run in parallel due to mocking configFile
+	defaultConfigFile := configFile
+
+	defer func() {
+		configFile = defaultConfigFile
+	}()
+
+	dir, err := ioutil.TempDir("", "picel")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	filename := writeConfigFile(t, dir, `{
+		"backend": "example.net",
+		"retries": 3,
+		"uploads": true,
+		"mirror": "example.net=m1.example.net",
+		"addr": ":8000"
+	}`)
+
+	args := []string{"-forward-header", "Cookie"}
+	fs, f, commandLine, err := loadTestConfig(t, args, filename, nil)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	writeConfigFile(t, dir, `{
+		"backend": "new.example.net",
+		"mirror": "new.example.net=m2.example.net",
+		"forward-header": "Accept-Language",
+		"addr": ":9000"
+	}`)
+
+	if err := reloadConfig(fs, filename, []string{"PICEL_RETRIES=4"}, commandLine); err != nil {
+		t.Fatalf("reloadConfig() should not fail, got %v instead", err)
+	}
+
+	want := testFlags{
+		backend: "new.example.net",
+		retries: 4,
+		size:    32 << 20,
+		forward: listFlag{"Cookie"},
+		mirrors: mirrorsFlag{"new.example.net": {"m2.example.net"}},
+		headers: backendHeadersFlag{},
+		addr:    ":8000",
+	}
+
+	if !reflect.DeepEqual(*f, want) {
+		t.Errorf("Reloaded flags == %+v, want %+v", *f, want)
+	}
+
+	writeConfigFile(t, dir, `{"unknown": true}`)
+
+	if err := reloadConfig(fs, filename, nil, commandLine); err == nil {
+		t.Errorf("reloadConfig() should fail for unknown options")
+	}
+
+	if f.backend != "new.example.net" {
+		t.Errorf("Flags should not change when reloading fails, got backend %v instead", f.backend)
+	}
+}
+
+func TestReloadableHandler(t *testing.T) {
+	t.Parallel()
+	h := &reloadableHandler{}
+
+	for _, body := range []string{"first", "second"} {
+		response := body
+
+		h.Store(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(response))
+		}))
+
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/", nil)
+		h.ServeHTTP(w, req)
+
+		if w.Body.String() != body {
+			t.Errorf("reloadableHandler served %q, want %q", w.Body.String(), body)
+		}
+	}
+}
@@ -0,0 +1,469 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	goimage "image"
+	"image/color"
+	"image/gif"
+	"image/png"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/henvic/picel/image"
+)
+
+// doctorTimeout is the timeout for running all the checks of picel doctor
+var doctorTimeout = 2 * time.Minute
+
+// minVersions are the minimum versions of the programs used by the engines
+var minVersions = map[string]string{
+	"convert":  "6.8.0",
+	"cwebp":    "0.5.0",
+	"gif2webp": "0.5.0",
+}
+
+var versionRegexp = regexp.MustCompile(`\d+(\.\d+)+`)
+
+// formatRegexp matches the lines of convert -list format, such as "     JPEG* JPEG      rw-   Joint Photographic..."
+var formatRegexp = regexp.MustCompile(`^\s*([A-Z0-9-]+)\*?\s+\S+\s+([r-][w-][+-])\s`)
+
+// diagnosis is the result of a check of picel doctor
+type diagnosis struct {
+	name string
+	info string
+	err  error
+}
+
+func (d diagnosis) String() string {
+	if d.err != nil {
+		return fmt.Sprintf("FAIL  %v: %v", d.name, d.err)
+	}
+
+	return fmt.Sprintf("ok    %v: %v", d.name, d.info)
+}
+
+// coderPolicy is a coder policy of ImageMagick, as listed by convert -list policy
+type coderPolicy struct {
+	rights  string
+	pattern string
+}
+
+// parseVersion returns the first version number on the output of a program, such as 6.9.11 for "Version: ImageMagick 6.9.11-60 Q16"
+func parseVersion(s string) string {
+	return versionRegexp.FindString(s)
+}
+
+// compareVersions returns -1, 0 or 1 if a is lower, equal or greater than b
+func compareVersions(a, b string) int {
+	as := strings.Split(a, ".")
+	bs := strings.Split(b, ".")
+
+	for i := 0; i < len(as) || i < len(bs); i++ {
+		var x, y int
+
+		if i < len(as) {
+			x, _ = strconv.Atoi(as[i])
+		}
+
+		if i < len(bs) {
+			y, _ = strconv.Atoi(bs[i])
+		}
+
+		switch {
+		case x < y:
+			return -1
+		case x > y:
+			return 1
+		}
+	}
+
+	return 0
+}
+
+// parseFormats returns the modes (such as rw+) of the formats listed by convert -list format
+func parseFormats(s string) map[string]string {
+	formats := map[string]string{}
+	scanner := bufio.NewScanner(strings.NewReader(s))
+
+	for scanner.Scan() {
+		if m := formatRegexp.FindStringSubmatch(scanner.Text()); m != nil {
+			formats[m[1]] = m[2]
+		}
+	}
+
+	return formats
+}
+
+// parsePolicies returns the coder policies listed by convert -list policy, in order
+func parsePolicies(s string) []coderPolicy {
+	var policies []coderPolicy
+	var coder bool
+	var current coderPolicy
+
+	flush := func() {
+		if coder && current.pattern != "" {
+			policies = append(policies, current)
+		}
+
+		current = coderPolicy{}
+	}
+
+	scanner := bufio.NewScanner(strings.NewReader(s))
+
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		parts := strings.SplitN(line, ":", 2)
+
+		if len(parts) != 2 {
+			continue
+		}
+
+		key := strings.ToLower(parts[0])
+		value := strings.TrimSpace(parts[1])
+
+		switch key {
+		case "policy":
+			flush()
+			coder = strings.EqualFold(value, "coder")
+		case "path":
+			flush()
+			coder = false
+		case "rights":
+			current.rights = strings.ToLower(value)
+		case "pattern":
+			current.pattern = value
+		}
+	}
+
+	flush()
+	return policies
+}
+
+// matchPattern tells if a format matches a policy pattern, such as PDF, {GIF,JPEG,PNG} or *
+func matchPattern(pattern, format string) bool {
+	pattern = strings.ToUpper(pattern)
+
+	if strings.HasPrefix(pattern, "{") && strings.HasSuffix(pattern, "}") {
+		for _, p := range strings.Split(pattern[1:len(pattern)-1], ",") {
+			if matchPattern(strings.TrimSpace(p), format) {
+				return true
+			}
+		}
+
+		return false
+	}
+
+	matched, _ := path.Match(pattern, format)
+	return matched
+}
+
+// policyAllows tells if the policies allow a right (read or write) on a format
+// The last policy matching the format is the one in effect
+func policyAllows(policies []coderPolicy, format, right string) bool {
+	allowed := true
+
+	for _, p := range policies {
+		if matchPattern(p.pattern, format) {
+			allowed = strings.Contains(p.rights, right) || strings.Contains(p.rights, "all")
+		}
+	}
+
+	return allowed
+}
+
+func checkPrograms(ctx context.Context) (diagnoses []diagnosis) {
+	for _, name := range image.Programs {
+		d := diagnosis{
+			name: name,
+		}
+
+		out, err := image.ProgramVersion(ctx, name)
+		version := parseVersion(out)
+		min, hasMin := minVersions[name]
+
+		switch {
+		case err != nil:
+			d.err = err
+		case hasMin && version == "":
+			d.err = fmt.Errorf("unknown version %q (minimum %v)", out, min)
+		case hasMin && compareVersions(version, min) < 0:
+			d.err = fmt.Errorf("version %v is older than the minimum %v", version, min)
+		case hasMin:
+			d.info = fmt.Sprintf("%v (minimum %v)", out, min)
+		default:
+			d.info = out
+		}
+
+		diagnoses = append(diagnoses, d)
+	}
+
+	return diagnoses
+}
+
+// imagickFormats returns the ImageMagick formats read or written by the engines, with the right required for each
+func imagickFormats() map[string]string {
+	formats := map[string]string{}
+
+	for mimeType := range image.ValidInputMimeTypes {
+		formats[strings.ToUpper(strings.TrimPrefix(mimeType, "image/"))] = "read"
+	}
+
+	for format, engine := range image.OutputFormats {
+		if engine != "Imagick" {
+			continue
+		}
+
+		f := strings.ToUpper(format)
+
+		switch formats[f] {
+		case "read":
+			formats[f] = "read|write"
+		default:
+			formats[f] = "write"
+		}
+	}
+
+	return formats
+}
+
+func checkImagickFormat(format, rights string, modes map[string]string, policies []coderPolicy) diagnosis {
+	d := diagnosis{
+		name: "ImageMagick " + format,
+	}
+
+	mode, ok := modes[format]
+
+	if !ok {
+		d.err = fmt.Errorf("format not supported (missing delegate library)")
+		return d
+	}
+
+	for _, right := range strings.Split(rights, "|") {
+		switch {
+		case right == "read" && mode[0] != 'r':
+			d.err = fmt.Errorf("can't read %v (mode %v, missing delegate library)", format, mode)
+		case right == "write" && mode[1] != 'w':
+			d.err = fmt.Errorf("can't write %v (mode %v, missing delegate library)", format, mode)
+		case !policyAllows(policies, format, right):
+			d.err = fmt.Errorf("%v of %v is not allowed by the security policy (policy.xml)", right, format)
+		}
+
+		if d.err != nil {
+			return d
+		}
+	}
+
+	d.info = fmt.Sprintf("%v (mode %v)", rights, mode)
+	return d
+}
+
+func checkImagick(ctx context.Context) (diagnoses []diagnosis) {
+	formatsOut, err := exec.CommandContext(ctx, "convert", "-list", "format").Output()
+
+	if err != nil {
+		return []diagnosis{{name: "ImageMagick formats", err: err}}
+	}
+
+	policyOut, err := exec.CommandContext(ctx, "convert", "-list", "policy").Output()
+
+	if err != nil {
+		return []diagnosis{{name: "ImageMagick policy", err: err}}
+	}
+
+	modes := parseFormats(string(formatsOut))
+	policies := parsePolicies(string(policyOut))
+	formats := imagickFormats()
+	var names []string
+
+	for format := range formats {
+		names = append(names, format)
+	}
+
+	sort.Strings(names)
+
+	for _, format := range names {
+		diagnoses = append(diagnoses, checkImagickFormat(format, formats[format], modes, policies))
+	}
+
+	return diagnoses
+}
+
+// testImage encodes a tiny image for the test conversions
+func testImage(format string) []byte {
+	img := goimage.NewPaletted(goimage.Rect(0, 0, 16, 16), color.Palette{color.White, color.Black})
+
+	for i := 0; i < 16; i++ {
+		img.SetColorIndex(i, i, 1)
+	}
+
+	var buf bytes.Buffer
+
+	switch format {
+	case "gif":
+		gif.Encode(&buf, img, nil)
+	default:
+		png.Encode(&buf, img)
+	}
+
+	return buf.Bytes()
+}
+
+func checkLibmagic() diagnosis {
+	d := diagnosis{
+		name: "libmagic",
+	}
+
+	if !image.LibmagicEnabled {
+		d.info = "not enabled (built without the libmagic tag, using the built-in mime type sniffer)"
+		return d
+	}
+
+	if err := image.Init(); err != nil {
+		d.err = err
+		return d
+	}
+
+	mimeType, err := image.Detector.TypeByBuffer(testImage("png"))
+
+	switch {
+	case err != nil:
+		d.err = err
+	case mimeType != "image/png":
+		d.err = fmt.Errorf("detected a PNG image as %v", mimeType)
+	default:
+		d.info = "enabled"
+	}
+
+	return d
+}
+
+func checkConversion(ctx context.Context, dir, input, output string) diagnosis {
+	d := diagnosis{
+		name: fmt.Sprintf("conversion from %v to %v", input, output),
+	}
+
+	in := filepath.Join(dir, "test."+input)
+	out := filepath.Join(dir, "test-"+input+"."+output)
+
+	if err := ioutil.WriteFile(in, testImage(input), 0644); err != nil {
+		d.err = err
+		return d
+	}
+
+	t := image.Transform{
+		Image: image.Image{
+			ID:        "test",
+			Extension: input,
+		},
+		Width:  8,
+		Output: output,
+	}
+
+	p := &image.Processor{}
+
+	if err := p.ProcessContext(ctx, t, in, out); err != nil {
+		d.err = err
+
+		if pe, ok := err.(*image.ProgramError); ok && pe.Stderr != "" {
+			d.err = fmt.Errorf("%v: %v", err, strings.TrimSpace(pe.Stderr))
+		}
+
+		return d
+	}
+
+	mimeType, err := image.Sniffer{}.TypeByFile(out)
+
+	switch {
+	case err != nil:
+		d.err = err
+	case mimeType != image.OutputContentTypes[output]:
+		d.err = fmt.Errorf("output is %v instead of %v", mimeType, image.OutputContentTypes[output])
+	default:
+		d.info = "ok"
+	}
+
+	return d
+}
+
+func checkConversions(ctx context.Context) (diagnoses []diagnosis) {
+	dir, err := ioutil.TempDir("", "picel-doctor")
+
+	if err != nil {
+		return []diagnosis{{name: "test conversions", err: err}}
+	}
+
+	defer os.RemoveAll(dir)
+
+	var outputs []string
+
+	for format := range image.OutputFormats {
+		outputs = append(outputs, format)
+	}
+
+	sort.Strings(outputs)
+
+	for _, output := range outputs {
+		diagnoses = append(diagnoses, checkConversion(ctx, dir, "png", output))
+	}
+
+	// gif2webp is only used for gif inputs
+	return append(diagnoses, checkConversion(ctx, dir, "gif", "webp"))
+}
+
+// doctor checks the environment, writing the result of each check to w
+// It returns false if any check fails
+func doctor(ctx context.Context, w io.Writer) bool {
+	var diagnoses []diagnosis
+	diagnoses = append(diagnoses, checkPrograms(ctx)...)
+	diagnoses = append(diagnoses, checkImagick(ctx)...)
+	diagnoses = append(diagnoses, checkLibmagic())
+	diagnoses = append(diagnoses, checkConversions(ctx)...)
+
+	var failures int
+
+	for _, d := range diagnoses {
+		fmt.Fprintln(w, d)
+
+		if d.err != nil {
+			failures++
+		}
+	}
+
+	if failures != 0 {
+		fmt.Fprintf(w, "%d of %d checks failed\n", failures, len(diagnoses))
+		return false
+	}
+
+	fmt.Fprintf(w, "All %d checks passed\n", len(diagnoses))
+	return true
+}
+
+// doctorCommand runs picel doctor, exiting with a non-zero status when a check fails
+func doctorCommand(args []string, stdin io.Reader, stdout io.Writer, stderr io.Writer) int {
+	fs := newCommandFlagSet("doctor", "", stderr)
+
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), doctorTimeout)
+	defer cancel()
+
+	if !doctor(ctx, stdout) {
+		return 1
+	}
+
+	return 0
+}
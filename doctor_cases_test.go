@@ -0,0 +1,58 @@
+package main
+
+var ParseVersionCases = []ParseVersionProvider{
+	{"Version: ImageMagick 6.9.11-60 Q16 x86_64 2021-01-25 https://imagemagick.org", "6.9.11"},
+	{"Version: ImageMagick 7.1.1-21 Q16-HDRI aarch64 21626", "7.1.1"},
+	{"1.2.4", "1.2.4"},
+	{"0.5.0", "0.5.0"},
+	{"unknown", ""},
+	{"", ""},
+}
+
+var CompareVersionsCases = []CompareVersionsProvider{
+	{"6.9.11", "6.8.0", 1},
+	{"6.8.0", "6.8.0", 0},
+	{"6.8", "6.8.0", 0},
+	{"0.4.4", "0.5.0", -1},
+	{"1.2.4", "0.5.0", 1},
+	{"6.10.0", "6.9.0", 1},
+}
+
+const formatsExample = `   Format  Module    Mode  Description
+-------------------------------------------------------------------------------
+      GIF* GIF       rw+   CompuServe graphics interchange format
+      JPEG* JPEG      rw-   Joint Photographic Experts Group JFIF format (80)
+       JPG* JPEG      rw-   Joint Photographic Experts Group JFIF format
+       PDF* PDF       rw+   Portable Document Format
+       PNG* PNG       r--   Portable Network Graphics (libpng 1.6.37)
+`
+
+const policiesExample = `
+Path: /etc/ImageMagick-6/policy.xml
+  Policy: Resource
+    name: disk
+    value: 1GiB
+  Policy: Coder
+    rights: None
+    pattern: PDF
+  Policy: Coder
+    rights: None
+    pattern: *
+  Policy: Coder
+    rights: Read Write
+    pattern: {GIF,JPEG,PNG,WEBP}
+
+Path: [built-in]
+  Policy: Undefined
+    rights: None
+`
+
+var CheckImagickFormatCases = []CheckImagickFormatProvider{
+	{"GIF", "read|write", true},
+	{"JPEG", "read|write", true},
+	{"JPG", "write", false},
+	{"PDF", "write", false},
+	{"PNG", "read", true},
+	{"PNG", "read|write", false},
+	{"WEBP", "read", false},
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/henvic/picel/image"
+)
+
+type ParseVersionProvider struct {
+	output  string
+	version string
+}
+
+type CompareVersionsProvider struct {
+	a    string
+	b    string
+	want int
+}
+
+type CheckImagickFormatProvider struct {
+	format string
+	rights string
+	pass   bool
+}
+
+func TestParseVersion(t *testing.T) {
+	t.Parallel()
+	for _, c := range ParseVersionCases {
+		if version := parseVersion(c.output); version != c.version {
+			t.Errorf("parseVersion(%q) == %q, want %q", c.output, version, c.version)
+		}
+	}
+}
+
+func TestCompareVersions(t *testing.T) {
+	t.Parallel()
+	for _, c := range CompareVersionsCases {
+		if got := compareVersions(c.a, c.b); got != c.want {
+			t.Errorf("compareVersions(%v, %v) == %v, want %v", c.a, c.b, got, c.want)
+		}
+	}
+}
+
+func TestParseFormats(t *testing.T) {
+	t.Parallel()
+	want := map[string]string{
+		"GIF":  "rw+",
+		"JPEG": "rw-",
+		"JPG":  "rw-",
+		"PDF":  "rw+",
+		"PNG":  "r--",
+	}
+
+	if formats := parseFormats(formatsExample); !reflect.DeepEqual(formats, want) {
+		t.Errorf("parseFormats() == %v, want %v", formats, want)
+	}
+}
+
+func TestParsePolicies(t *testing.T) {
+	t.Parallel()
+	want := []coderPolicy{
+		{"none", "PDF"},
+		{"none", "*"},
+		{"read write", "{GIF,JPEG,PNG,WEBP}"},
+	}
+
+	if policies := parsePolicies(policiesExample); !reflect.DeepEqual(policies, want) {
+		t.Errorf("parsePolicies() == %v, want %v", policies, want)
+	}
+}
+
+func TestCheckImagickFormat(t *testing.T) {
+	t.Parallel()
+	modes := parseFormats(formatsExample)
+	policies := parsePolicies(policiesExample)
+
+	for _, c := range CheckImagickFormatCases {
+		d := checkImagickFormat(c.format, c.rights, modes, policies)
+
+		if (d.err == nil) != c.pass {
+			t.Errorf("checkImagickFormat(%v, %v) returned %v, want pass: %v", c.format, c.rights, d, c.pass)
+		}
+	}
+}
+
+func TestDoctorFailure(t *testing.T) {
+	// don't run in parallel due to mocking image.Programs
+	defaultPrograms := image.Programs
+	image.Programs = []string{"picel-missing-program"}
+
+	defer func() {
+		image.Programs = defaultPrograms
+	}()
+
+	var out bytes.Buffer
+
+	if doctor(context.Background(), &out) {
+		t.Errorf("doctor() should fail when a program is missing")
+	}
+
+	if !strings.Contains(out.String(), "FAIL  picel-missing-program: ") || !strings.Contains(out.String(), "checks failed") {
+		t.Errorf("Unexpected doctor() output: %v", out.String())
+	}
+}
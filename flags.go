@@ -0,0 +1,187 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/henvic/picel/client"
+)
+
+// listFlag is a list of comma-separated flag values
+type listFlag []string
+
+func (l *listFlag) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *listFlag) reset() {
+	*l = nil
+}
+
+func (l *listFlag) Set(value string) error {
+	for _, v := range strings.Split(value, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			*l = append(*l, v)
+		}
+	}
+
+	return nil
+}
+
+// byteSizeFlag is a size in bytes, with an optional KB, MB or GB suffix
+type byteSizeFlag int64
+
+var byteSizeUnits = []struct {
+	suffix string
+	size   int64
+}{
+	{"GB", 1 << 30},
+	{"MB", 1 << 20},
+	{"KB", 1 << 10},
+	{"B", 1},
+}
+
+func (b *byteSizeFlag) String() string {
+	if b == nil {
+		return "0"
+	}
+
+	for _, u := range byteSizeUnits {
+		if *b != 0 && int64(*b)%u.size == 0 {
+			return fmt.Sprintf("%d%s", int64(*b)/u.size, u.suffix)
+		}
+	}
+
+	return "0"
+}
+
+func (b *byteSizeFlag) Set(value string) error {
+	v := strings.ToUpper(strings.TrimSpace(value))
+	unit := int64(1)
+
+	for _, u := range byteSizeUnits {
+		if strings.HasSuffix(v, u.suffix) {
+			v, unit = strings.TrimSpace(strings.TrimSuffix(v, u.suffix)), u.size
+			break
+		}
+	}
+
+	size, err := strconv.ParseInt(v, 10, 64)
+
+	if err != nil || size < 0 || size > math.MaxInt64/unit {
+		return fmt.Errorf("invalid size %q", value)
+	}
+
+	*b = byteSizeFlag(size * unit)
+	return nil
+}
+
+// mirrorsFlag is a list of <backend>=<mirror>[,<mirror>...] flag values
+type mirrorsFlag map[string][]string
+
+func (m mirrorsFlag) String() string {
+	var values []string
+
+	for backend, list := range m {
+		values = append(values, backend+"="+strings.Join(list, ","))
+	}
+
+	return strings.Join(values, " ")
+}
+
+func (m mirrorsFlag) reset() {
+	for backend := range m {
+		delete(m, backend)
+	}
+}
+
+func (m mirrorsFlag) Set(value string) error {
+	parts := strings.SplitN(value, "=", 2)
+
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return fmt.Errorf("invalid mirror %q, want <backend>=<mirror>[,<mirror>...]", value)
+	}
+
+	m[parts[0]] = append(m[parts[0]], strings.Split(parts[1], ",")...)
+	return nil
+}
+
+// backendHeadersFlag is a list of <backend>=<header> flag values
+type backendHeadersFlag map[string]http.Header
+
+type backendHeaderFlag struct {
+	headers backendHeadersFlag
+	kind    string
+}
+
+func (b backendHeadersFlag) kind(kind string) *backendHeaderFlag {
+	return &backendHeaderFlag{
+		headers: b,
+		kind:    kind,
+	}
+}
+
+// String never returns the header values, as they might be secret
+func (b *backendHeaderFlag) String() string {
+	if b == nil {
+		return ""
+	}
+
+	var values []string
+
+	for backend, h := range b.headers {
+		values = append(values, backend+"="+strings.Join(client.HeaderNames(h), ","))
+	}
+
+	return strings.Join(values, " ")
+}
+
+// reset clears the headers of all kinds
+func (b *backendHeaderFlag) reset() {
+	for backend := range b.headers {
+		delete(b.headers, backend)
+	}
+}
+
+func (b *backendHeaderFlag) Set(value string) error {
+	parts := strings.SplitN(value, "=", 2)
+
+	if len(parts) != 2 || parts[0] == "" {
+		return fmt.Errorf("invalid %v, want <backend>=<value>", b.kind)
+	}
+
+	backend, v := parts[0], os.ExpandEnv(parts[1])
+	name, header := "Authorization", ""
+
+	switch b.kind {
+	case "basic":
+		credentials := strings.SplitN(v, ":", 2)
+
+		if len(credentials) != 2 {
+			return fmt.Errorf("invalid basic authentication for %v, want <username>:<password>", backend)
+		}
+
+		header = client.BasicAuth(credentials[0], credentials[1])
+	case "bearer":
+		header = client.BearerAuth(v)
+	default:
+		h := strings.SplitN(v, ":", 2)
+
+		if len(h) != 2 || strings.TrimSpace(h[0]) == "" {
+			return fmt.Errorf("invalid header for %v, want <name>: <value>", backend)
+		}
+
+		name, header = strings.TrimSpace(h[0]), strings.TrimSpace(h[1])
+	}
+
+	if b.headers[backend] == nil {
+		b.headers[backend] = http.Header{}
+	}
+
+	b.headers[backend].Set(name, header)
+	return nil
+}
@@ -0,0 +1,49 @@
+package main
+
+var ListFlagCases = []ListFlagProvider{
+	{[]string{}, nil},
+	{[]string{"Authorization"}, listFlag{"Authorization"}},
+	{[]string{"Authorization, Cookie", "X-Api-Key"}, listFlag{"Authorization", "Cookie", "X-Api-Key"}},
+	{[]string{","}, nil},
+}
+
+var ByteSizeFlagCases = []ByteSizeFlagProvider{
+	{"0", 0, "0", false},
+	{"100", 100, "100B", false},
+	{"100B", 100, "100B", false},
+	{"2048", 2048, "2KB", false},
+	{"512kb", 512 << 10, "512KB", false},
+	{"20MB", 20 << 20, "20MB", false},
+	{"1 GB", 1 << 30, "1GB", false},
+	{"1536MB", 1536 << 20, "1536MB", false},
+	{"-1", 0, "", true},
+	{"MB", 0, "", true},
+	{"1TB", 0, "", true},
+	{"8589934591GB", 8589934591 << 30, "8589934591GB", false},
+	{"8589934592GB", 0, "", true},
+	{"9223372036854775807", 9223372036854775807, "9223372036854775807B", false},
+	{"9223372036854775808", 0, "", true},
+}
+
+var MirrorsFlagCases = []MirrorsFlagProvider{
+	{[]string{}, mirrorsFlag{}, false},
+	{[]string{"example.net=mirror.example.net"}, mirrorsFlag{"example.net": {"mirror.example.net"}}, false},
+	{[]string{"example.net=a.example.net,s:b.example.net"}, mirrorsFlag{"example.net": {"a.example.net", "s:b.example.net"}}, false},
+	{[]string{"example.net=a.example.net", "example.net=b.example.net", "s:example.com=c.example.com"},
+		mirrorsFlag{"example.net": {"a.example.net", "b.example.net"}, "s:example.com": {"c.example.com"}}, false},
+	{[]string{"example.net"}, nil, true},
+	{[]string{"=example.net"}, nil, true},
+	{[]string{"example.net="}, nil, true},
+}
+
+var BackendHeaderFlagCases = []BackendHeaderFlagProvider{
+	{"header", "example.net=X-Api-Key: foo", backendHeadersFlag{"example.net": {"X-Api-Key": {"foo"}}}, false},
+	{"header", "example.net=X-Api-Key: $PICEL_TEST_TOKEN", backendHeadersFlag{"example.net": {"X-Api-Key": {"secret"}}}, false},
+	{"header", "example.net=X-Api-Key", nil, true},
+	{"header", "example.net=: foo", nil, true},
+	{"header", "X-Api-Key: foo", nil, true},
+	{"basic", "example.net=user:pass", backendHeadersFlag{"example.net": {"Authorization": {"Basic dXNlcjpwYXNz"}}}, false},
+	{"basic", "example.net=user", nil, true},
+	{"bearer", "s:example.net=$PICEL_TEST_TOKEN", backendHeadersFlag{"s:example.net": {"Authorization": {"Bearer secret"}}}, false},
+	{"bearer", "=token", nil, true},
+}
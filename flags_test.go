@@ -0,0 +1,113 @@
+package main
+
+import (
+	"net/http"
+	"os"
+	"reflect"
+	"testing"
+)
+
+type ListFlagProvider struct {
+	values []string
+	want   listFlag
+}
+
+type ByteSizeFlagProvider struct {
+	value string
+	want  byteSizeFlag
+	str   string
+	fail  bool
+}
+
+type MirrorsFlagProvider struct {
+	values []string
+	want   mirrorsFlag
+	fail   bool
+}
+
+type BackendHeaderFlagProvider struct {
+	kind  string
+	value string
+	want  backendHeadersFlag
+	fail  bool
+}
+
+func TestByteSizeFlag(t *testing.T) {
+	for _, c := range ByteSizeFlagCases {
+		var b byteSizeFlag
+		err := b.Set(c.value)
+
+		if (err != nil) != c.fail {
+			t.Errorf("Set(%v) error is %v, want failure %v", c.value, err, c.fail)
+		}
+
+		if !c.fail && (b != c.want || b.String() != c.str) {
+			t.Errorf("Set(%v) == %v (%v), want %v (%v)", c.value, b, b.String(), c.want, c.str)
+		}
+	}
+}
+
+func TestMirrorsFlag(t *testing.T) {
+	for _, c := range MirrorsFlagCases {
+		m := mirrorsFlag{}
+		var err error
+
+		for _, v := range c.values {
+			if err = m.Set(v); err != nil {
+				break
+			}
+		}
+
+		if (err != nil) != c.fail {
+			t.Errorf("Set(%v) error is %v, want failure %v", c.values, err, c.fail)
+		}
+
+		if !c.fail && !reflect.DeepEqual(m, c.want) {
+			t.Errorf("Set(%v) == %v, want %v", c.values, m, c.want)
+		}
+	}
+}
+
+func TestListFlag(t *testing.T) {
+	for _, c := range ListFlagCases {
+		var l listFlag
+
+		for _, v := range c.values {
+			l.Set(v)
+		}
+
+		if !reflect.DeepEqual(l, c.want) {
+			t.Errorf("Set(%v) == %v, want %v", c.values, l, c.want)
+		}
+	}
+}
+
+func TestBackendHeaderFlag(t *testing.T) {
+	defer os.Setenv("PICEL_TEST_TOKEN", os.Getenv("PICEL_TEST_TOKEN"))
+	os.Setenv("PICEL_TEST_TOKEN", "secret")
+
+	for _, c := range BackendHeaderFlagCases {
+		h := backendHeadersFlag{}
+		err := h.kind(c.kind).Set(c.value)
+
+		if (err != nil) != c.fail {
+			t.Errorf("Set(%v) for %v error is %v, want failure %v", c.value, c.kind, err, c.fail)
+		}
+
+		if !c.fail && !reflect.DeepEqual(h, c.want) {
+			t.Errorf("Set(%v) for %v == %v, want %v", c.value, c.kind, h, c.want)
+		}
+	}
+}
+
+func TestBackendHeaderFlagString(t *testing.T) {
+	h := backendHeadersFlag{
+		"example.net": http.Header{
+			"Authorization": {"Bearer secret"},
+		},
+	}
+
+	if got := h.kind("bearer").String(); got != "example.net=Authorization" {
+		t.Errorf("String() == %v, want %v", got, "example.net=Authorization")
+	}
+}
@@ -2,14 +2,14 @@ package image
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
-	"log"
+	"io"
+	"os"
 	"os/exec"
+	"strconv"
 	"strings"
-
-	"github.com/henvic/picel/logger"
-	"github.com/rakyll/magicmime"
 )
 
 const (
@@ -32,8 +32,25 @@ var (
 
 	// Verbose mode for the bridge module
 	Verbose = false
+
+	// Detector of the mime type of the loaded files
+	Detector MimeTypeDetector = Sniffer{}
+
+	// TempDir for the temporary files of the programs (the default directory for temporary files is used if empty)
+	TempDir string
 )
 
+// ProgramError is returned when an image processing program fails
+type ProgramError struct {
+	Program string
+	Err     error
+	Stderr  string
+}
+
+func (e *ProgramError) Error() string {
+	return fmt.Sprintf("%v failed: %v", e.Program, e.Err)
+}
+
 // OutputFormats is a list of supported output formats and the engines that should process it
 var OutputFormats = map[string]string{
 	"jpg":  "Imagick",
@@ -44,6 +61,16 @@ var OutputFormats = map[string]string{
 	"webp": "Webp",
 }
 
+// OutputContentTypes maps the output formats to their content types
+var OutputContentTypes = map[string]string{
+	"jpg":  "image/jpeg",
+	"jpeg": "image/jpeg",
+	"gif":  "image/gif",
+	"png":  "image/png",
+	"pdf":  "application/pdf",
+	"webp": "image/webp",
+}
+
 // ValidInputMimeTypes is a list of supported input formats
 var ValidInputMimeTypes = map[string]bool{
 	"image/jpeg": true,
@@ -52,102 +79,132 @@ var ValidInputMimeTypes = map[string]bool{
 	"image/gif":  true,
 }
 
-func init() {
-	if err := magicmime.Open(
-		magicmime.MAGIC_MIME_TYPE |
-			magicmime.MAGIC_SYMLINK |
-			magicmime.MAGIC_ERROR); err != nil {
-		log.Fatal(err)
-	}
+// InputExtensions maps the supported input formats to the extension used by the engines
+var InputExtensions = map[string]string{
+	"image/jpeg": "jpg",
+	"image/png":  "png",
+	"image/webp": "webp",
+	"image/gif":  "gif",
 }
 
-// Process an image using a transformation to output a file
-func Process(t Transform, input string, output string) (err error) {
-	tool, valid := OutputFormats[strings.ToLower(t.Output)]
-
-	if !valid {
-		return ErrOutputFormatNotSupported
-	}
-
-	mimeType, mimeErr := magicmime.TypeByFile(input)
+// Init the bridge module, using libmagic as the mime type detector when built with the libmagic tag
+func Init() error {
+	return initDetector()
+}
 
-	if mimeErr != nil {
-		return ErrMimeTypeExtension
+func quality(t Transform, defaultQuality string) string {
+	if t.Quality > 0 {
+		return strconv.Itoa(t.Quality)
 	}
 
-	if !ValidInputMimeTypes[mimeType] {
-		return ErrMimeTypeNotSupported
-	}
+	return defaultQuality
+}
 
-	if tool == "Imagick" {
-		return processImagick(t, input, output)
+// Process an image using a transformation to output a file with the default processor
+func Process(t Transform, input string, output string) (err error) {
+	p := &Processor{
+		Verbose: Verbose,
 	}
 
-	return processWebp(t, input, output)
+	return p.Process(t, input, output)
 }
 
-func callProgram(name string, params []string) error {
-	cmd := exec.Command(name, params...)
+// callProgram runs a program reading the input from stdin and writing the output to stdout
+// The stdout is logged instead when the output is nil on verbose mode
+func (p *Processor) callProgram(ctx context.Context, name string, params []string, input io.Reader, output io.Writer) error {
+	cmd := exec.CommandContext(ctx, name, params...)
 	var bOut bytes.Buffer
 	var bErr bytes.Buffer
-	cmd.Stdout = &bOut
+	cmd.Stdin = input
+	cmd.Stdout = output
 	cmd.Stderr = &bErr
 
-	if Verbose {
-		logger.Stdout.Println(fmt.Sprintf("%v %v", name, strings.Join(params, " ")))
+	if TempDir != "" {
+		cmd.Env = append(os.Environ(), "MAGICK_TEMPORARY_PATH="+TempDir)
+	}
+
+	if output == nil {
+		cmd.Stdout = &bOut
+	}
+
+	if p.Verbose {
+		p.stdout().Println(fmt.Sprintf("%v %v", name, strings.Join(params, " ")))
 	}
 
 	cmdErr := cmd.Run()
 
-	if Verbose {
-		logger.Stdout.Println(string(bOut.Bytes()))
-		logger.Stderr.Println(string(bErr.Bytes()))
+	if p.Verbose {
+		if output == nil {
+			p.stdout().Println(string(bOut.Bytes()))
+		}
+
+		p.stderr().Println(string(bErr.Bytes()))
+	}
+
+	if cmdErr != nil {
+		return &ProgramError{
+			Program: name,
+			Err:     cmdErr,
+			Stderr:  bErr.String(),
+		}
 	}
 
-	return cmdErr
+	return nil
 }
 
-func processWebp(t Transform, input string, output string) (err error) {
+func (p *Processor) processWebp(ctx context.Context, t Transform, input io.Reader, output io.Writer) (err error) {
 	if t.Extension != "gif" {
-		return processCwebp(t, input, output)
+		return p.processCwebp(ctx, t, input, output)
 	}
 
 	if t.Crop.Width != 0 || t.Crop.Height != 0 || t.Width != 0 || t.Height != 0 {
+		var gif bytes.Buffer
 		t.Output = "gif"
-		err = processImagick(t, input, output)
-		t.Output = "webp"
-		input = output
 
-		if err != nil {
+		if err = p.processImagick(ctx, t, input, &gif); err != nil {
 			return err
 		}
+
+		input = &gif
 	}
 
-	return processGif2Webp(input, output)
+	return p.processGif2Webp(ctx, t, input, output)
 }
 
-func processGif2Webp(input string, output string) (err error) {
+// processGif2Webp uses a temporary input file as gif2webp can't read from stdin
+func (p *Processor) processGif2Webp(ctx context.Context, t Transform, input io.Reader, output io.Writer) (err error) {
 	var params []string
 
 	params = append(params, "-q")
-	params = append(params, WebpQuality)
+	params = append(params, quality(t, WebpQuality))
 
-	if Verbose {
+	if p.Verbose {
 		params = append(params, "-v")
 	}
 
-	params = append(params, input)
+	filename, err := writeTempFile(input)
+
+	if filename != "" {
+		defer os.Remove(filename)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	params = append(params, filename)
 	params = append(params, "-o")
-	params = append(params, output)
+	params = append(params, "-")
 
-	return callProgram("gif2webp", params)
+	return p.callProgram(ctx, "gif2webp", params, nil, output)
 }
 
-func processCwebp(t Transform, input string, output string) (err error) {
+// processCwebp uses a temporary input file as cwebp can't read from stdin
+func (p *Processor) processCwebp(ctx context.Context, t Transform, input io.Reader, output io.Writer) (err error) {
 	var params []string
 
 	params = append(params, "-q")
-	params = append(params, WebpQuality)
+	params = append(params, quality(t, WebpQuality))
 
 	if t.Crop.Width != 0 && t.Crop.Height != 0 {
 		params = append(params, "-crop")
@@ -163,29 +220,39 @@ func processCwebp(t Transform, input string, output string) (err error) {
 		params = append(params, fmt.Sprintf("%d", t.Height))
 	}
 
-	if Verbose {
+	if p.Verbose {
 		params = append(params, "-v")
 	}
 
-	params = append(params, input)
+	filename, err := writeTempFile(input)
+
+	if filename != "" {
+		defer os.Remove(filename)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	params = append(params, filename)
 	params = append(params, "-o")
-	params = append(params, output)
+	params = append(params, "-")
 
-	return callProgram("cwebp", params)
+	return p.callProgram(ctx, "cwebp", params, nil, output)
 }
 
-func processImagick(t Transform, input string, output string) (err error) {
+func (p *Processor) processImagick(ctx context.Context, t Transform, input io.Reader, output io.Writer) (err error) {
 	var params []string
 
-	if Verbose {
+	if p.Verbose {
 		params = append(params, "-verbose")
 	}
 
 	params = append(params, "-quality")
 
-	params = append(params, ImagickQuality)
+	params = append(params, quality(t, ImagickQuality))
 
-	params = append(params, input)
+	params = append(params, "-")
 
 	params = append(params, "-strip")
 
@@ -215,9 +282,7 @@ func processImagick(t Transform, input string, output string) (err error) {
 		params = append(params, resize)
 	}
 
-	output = strings.ToLower(t.Output) + ":" + output
-
-	params = append(params, output)
+	params = append(params, strings.ToLower(t.Output)+":-")
 
-	return callProgram("convert", params)
+	return p.callProgram(ctx, "convert", params, input, output)
 }
@@ -6,6 +6,7 @@ package image
 import (
 	"errors"
 	"fmt"
+	"math"
 	"strconv"
 	"strings"
 )
@@ -16,6 +17,9 @@ const (
 
 	// Raw is a special parameter to output a given image "as is" (acting like a proxy)
 	Raw = "raw"
+
+	// MaxDPR is the maximum device pixel ratio
+	MaxDPR = 4
 )
 
 var (
@@ -40,6 +44,9 @@ var (
 	// ErrInvalidCropDimensions is returned when the crop format dimensions is invalid
 	ErrInvalidCropDimensions = errors.New("Invalid crop format dimensions")
 
+	// ErrInvalidDPR is returned when a device pixel ratio is not in the @<dpr>x format or is out of range
+	ErrInvalidDPR = errors.New("DPR must be in the @<dpr>x format, greater than zero and up to 4")
+
 	// ErrNonEmptyParameterQueue is returned when there are parameters left after processing a transformation
 	ErrNonEmptyParameterQueue = errors.New("Can't process all parameters")
 )
@@ -62,12 +69,16 @@ type Crop struct {
 // Transform structure
 type Transform struct {
 	Image  `json:"image"`
-	Path   string `json:"path"`
-	Raw    bool   `json:"original"`
-	Width  int    `json:"width"`
-	Height int    `json:"height"`
-	Crop   Crop   `json:"crop"`
-	Output string `json:"output"`
+	Path   string  `json:"path"`
+	Raw    bool    `json:"original"`
+	Width  int     `json:"width"`
+	Height int     `json:"height"`
+	Crop   Crop    `json:"crop"`
+	DPR    float64 `json:"dpr,omitempty"`
+	Output string  `json:"output"`
+
+	// Quality of the output (the engine default is used when zero)
+	Quality int `json:"quality,omitempty"`
 }
 
 // Name of the image
@@ -157,17 +168,61 @@ func Encode(transform Transform) (url string) {
 
 	url += EncodeParam(encodeDimension(transform.Width, transform.Height))
 
-	if transform.Output != inputExtension && (inputExtension != DefaultInputExtension || transform.Output != "") {
+	dpr := EncodeDPR(transform.DPR)
+	url += EncodeParam(dpr)
+	output := GetEncodingOutput(transform.Output, dpr, inputExtension)
+
+	if output != inputExtension && (inputExtension != DefaultInputExtension || output != "") {
 		url += EncodeParam(EscapePath(inputExtension))
 	}
 
-	if transform.Output != "" {
-		url += "." + EscapePath(transform.Output)
+	if output != "" {
+		url += "." + EscapePath(output)
 	}
 
 	return url
 }
 
+// GetEncodingOutput returns the output format of an encoded path with the given DPR parameter and input extension
+// A fractional DPR, such as @1.5x, requires the output extension, or its "." would be read as one
+func GetEncodingOutput(output, dpr, inputExtension string) string {
+	if output == "" && strings.Contains(dpr, ".") {
+		return inputExtension
+	}
+
+	return output
+}
+
+// EncodeDPR as a parameter, omitting the default 1x
+func EncodeDPR(dpr float64) string {
+	if dpr == 0 || dpr == 1 {
+		return ""
+	}
+
+	return "@" + strconv.FormatFloat(dpr, 'f', -1, 64) + "x"
+}
+
+// ApplyDPR returns the transformation with the dimensions multiplied by the DPR
+// The crop size is used as the dimensions when only cropping
+func (t Transform) ApplyDPR() Transform {
+	dpr := t.DPR
+	t.DPR = 0
+
+	if dpr == 0 || dpr == 1 {
+		return t
+	}
+
+	width, height := t.Width, t.Height
+
+	if width == 0 && height == 0 {
+		width, height = t.Crop.Width, t.Crop.Height
+	}
+
+	t.Width = int(math.Floor(float64(width)*dpr + 0.5))
+	t.Height = int(math.Floor(float64(height)*dpr + 0.5))
+	return t
+}
+
 // EscapePath of an image
 func EscapePath(raw string) string {
 	return strings.Replace(raw, "_", "__", -1)
@@ -278,6 +333,29 @@ func getOffsets(c string) (x int, y int, errs []error) {
 	return x, y, errs
 }
 
+// ValidDPR tells if a device pixel ratio is a number greater than zero and up to MaxDPR
+func ValidDPR(dpr float64) bool {
+	return !math.IsNaN(dpr) && !math.IsInf(dpr, 0) && dpr > 0 && dpr <= MaxDPR
+}
+
+func getDPR(c string) (dpr float64, err error) {
+	if len(c) < 3 || c[0] != '@' || c[len(c)-1] != 'x' {
+		return dpr, ErrInvalidDPR
+	}
+
+	dpr, err = strconv.ParseFloat(c[1:len(c)-1], 64)
+
+	if err != nil || !ValidDPR(dpr) {
+		return 0, ErrInvalidDPR
+	}
+
+	if dpr == 1 {
+		dpr = 0
+	}
+
+	return dpr, nil
+}
+
 func getDimensions(c string) (x int, y int, errs []error) {
 	x, y, errs = getOffsets(c)
 
@@ -361,6 +439,17 @@ func extractParams(part string, output string, t *Transform) (errs []error, err
 		errs = append(errs, errsResize...)
 	}
 
+	if pos < len(params) && strings.HasPrefix(params[pos], "@") {
+		t.DPR, err = getDPR(params[pos])
+
+		if err != nil {
+			errs = append(errs, err)
+			return errs, err
+		}
+
+		pos++
+	}
+
 	extension := output
 
 	if pos != len(params) && params[pos] != "" {
@@ -120,6 +120,39 @@ var GetDimensionsFailureCases = []GetDimensionsFailureProvider{
 	{"0x0"},
 }
 
+var GetDPRCases = []GetDPRProvider{
+	{"@2x", 2},
+	{"@1.5x", 1.5},
+	{"@4x", 4},
+	{"@1x", 0},
+}
+
+var GetDPRFailureCases = []GetDPRFailureProvider{
+	{""},
+	{"@"},
+	{"@x"},
+	{"@2"},
+	{"2x"},
+	{"@0x"},
+	{"@-1x"},
+	{"@4.5x"},
+	{"@yx"},
+	{"@NaNx"},
+	{"@nanx"},
+	{"@Infx"},
+	{"@+Infx"},
+	{"@-Infx"},
+}
+
+var ApplyDPRCases = []ApplyDPRProvider{
+	{Transform{Width: 300, Height: 200}, 300, 200},
+	{Transform{Width: 300, Height: 200, DPR: 2}, 600, 400},
+	{Transform{Width: 300, DPR: 1.5}, 450, 0},
+	{Transform{Crop: Crop{Width: 100, Height: 50}, DPR: 2}, 200, 100},
+	{Transform{Crop: Crop{Width: 100, Height: 50}, Width: 30, DPR: 3}, 90, 0},
+	{Transform{DPR: 2}, 0, 0},
+}
+
 var GetOutputCases = []GetOutputProvider{
 	{"", "", ""},
 	{"file", "file", ""},
@@ -128,6 +161,10 @@ var GetOutputCases = []GetOutputProvider{
 
 var DecodingFailureUnknownParameterCases = []DecodingFailureUnknownParameterProvider{
 	{"la__office/newborn__bunnies_raw_stars.jpg"},
+	{"la__office/newborn__bunnies_400x_@2.jpg"},
+	{"la__office/newborn__bunnies_400x_@5x.jpg"},
+	{"la__office/newborn__bunnies_400x_@0x.jpg"},
+	{"la__office/newborn__bunnies_400x_@x.jpg"},
 }
 
 var DecodingFailureCases = []DecodingFailureProvider{
@@ -167,6 +204,31 @@ var CompleteEncodingAndDecodingCases = []CompleteEncodingAndDecodingProvider{
 		Width:  800,
 		Output: "webp",
 	}, "help/staff_800x.webp"},
+	{Transform{
+		Image: Image{
+			ID:        "help/staff",
+			Extension: "webp",
+			Source:    "help/staff.webp",
+		},
+		Path:   "help/staff_800x_@2x.webp",
+		Width:  800,
+		DPR:    2,
+		Output: "webp",
+	}, "help/staff_800x_@2x.webp"},
+	{Transform{
+		Image: Image{
+			ID:        "help/staff",
+			Extension: "jpg",
+			Source:    "help/staff.jpg",
+		},
+		Path: "help/staff_0x0:400x300_@1.5x_jpg.webp",
+		Crop: Crop{
+			Width:  400,
+			Height: 300,
+		},
+		DPR:    1.5,
+		Output: "webp",
+	}, "help/staff_0x0:400x300_@1.5x_jpg.webp"},
 	{Transform{
 		Image: Image{
 			ID:        "help/staff",
@@ -375,6 +437,30 @@ var CompleteEncodingAndDecodingCases = []CompleteEncodingAndDecodingProvider{
 		Output: "jpg",
 	}, "la__office/newborn__bunnies_raw.jpg",
 	},
+	{Transform{
+		Image: Image{
+			ID:        "foo",
+			Extension: "jpg",
+			Source:    "foo.jpg",
+		},
+		Path:   "foo_400x_@1.5x.jpg",
+		Width:  400,
+		DPR:    1.5,
+		Output: "jpg",
+	}, "foo_400x_@1.5x.jpg",
+	},
+	{Transform{
+		Image: Image{
+			ID:        "foo",
+			Extension: "png",
+			Source:    "foo.png",
+		},
+		Path:   "foo_400x_@1.5x.png",
+		Width:  400,
+		DPR:    1.5,
+		Output: "png",
+	}, "foo_400x_@1.5x.png",
+	},
 }
 
 var DecodingToDefaultOutputFormatCases = []DecodingToDefaultOutputFormatProvider{
@@ -441,6 +527,29 @@ var DecodingToDefaultOutputFormatCases = []DecodingToDefaultOutputFormatProvider
 }
 
 var IncompleteEncodingCases = []IncompleteEncodingProvider{
+	{Transform{
+		Image: Image{
+			ID:        "foo",
+			Extension: "jpg",
+		},
+		Width: 400,
+		DPR:   1.5,
+	}, "foo_400x_@1.5x.jpg"},
+	{Transform{
+		Image: Image{
+			ID:        "foo",
+			Extension: "png",
+		},
+		Width: 400,
+		DPR:   1.5,
+	}, "foo_400x_@1.5x.png"},
+	{Transform{
+		Image: Image{
+			ID: "foo",
+		},
+		Width: 400,
+		DPR:   2,
+	}, "foo_400x_@2x"},
 	{Transform{
 		Image: Image{
 			ID:        "la_office/newborn_bunnies",
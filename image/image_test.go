@@ -65,6 +65,21 @@ type GetDimensionsFailureProvider struct {
 	in string
 }
 
+type GetDPRProvider struct {
+	in  string
+	dpr float64
+}
+
+type GetDPRFailureProvider struct {
+	in string
+}
+
+type ApplyDPRProvider struct {
+	in     Transform
+	width  int
+	height int
+}
+
 type GetOutputProvider struct {
 	in     string
 	prefix string
@@ -221,6 +236,36 @@ func TestGetDimensionsFailure(t *testing.T) {
 	}
 }
 
+func TestGetDPR(t *testing.T) {
+	for _, c := range GetDPRCases {
+		dpr, err := getDPR(c.in)
+
+		if dpr != c.dpr || err != nil {
+			t.Errorf("getDPR(%q) == %v, %v, want %v, nil", c.in, dpr, err, c.dpr)
+		}
+	}
+}
+
+func TestGetDPRFailure(t *testing.T) {
+	for _, c := range GetDPRFailureCases {
+		_, err := getDPR(c.in)
+
+		if err != ErrInvalidDPR {
+			t.Errorf("getDPR(%q) should fail with %v, got %v instead", c.in, ErrInvalidDPR, err)
+		}
+	}
+}
+
+func TestApplyDPR(t *testing.T) {
+	for _, c := range ApplyDPRCases {
+		got := c.in.ApplyDPR()
+
+		if got.Width != c.width || got.Height != c.height || got.DPR != 0 {
+			t.Errorf("%+v.ApplyDPR() == %+v, want dimensions %dx%d", c.in, got, c.width, c.height)
+		}
+	}
+}
+
 func TestGetOutput(t *testing.T) {
 	for _, c := range GetOutputCases {
 		prefix, suffix := GetFilePathParts(c.in)
@@ -0,0 +1,34 @@
+//go:build libmagic
+// +build libmagic
+
+package image
+
+import "github.com/rakyll/magicmime"
+
+// LibmagicEnabled tells if picel was built with libmagic support
+const LibmagicEnabled = true
+
+// Libmagic detects the mime type of files using libmagic
+type Libmagic struct{}
+
+// TypeByFile returns the mime type of a file
+func (Libmagic) TypeByFile(filename string) (string, error) {
+	return magicmime.TypeByFile(filename)
+}
+
+// TypeByBuffer returns the mime type of the content starting with the given buffer
+func (Libmagic) TypeByBuffer(buf []byte) (string, error) {
+	return magicmime.TypeByBuffer(buf)
+}
+
+func initDetector() error {
+	if err := magicmime.Open(
+		magicmime.MAGIC_MIME_TYPE |
+			magicmime.MAGIC_SYMLINK |
+			magicmime.MAGIC_ERROR); err != nil {
+		return err
+	}
+
+	Detector = Libmagic{}
+	return nil
+}
@@ -0,0 +1,11 @@
+//go:build !libmagic
+// +build !libmagic
+
+package image
+
+// LibmagicEnabled tells if picel was built with libmagic support
+const LibmagicEnabled = false
+
+func initDetector() error {
+	return nil
+}
@@ -0,0 +1,184 @@
+package image
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/henvic/picel/logger"
+)
+
+// Engine processes an input image into an output image with a transformation
+type Engine func(p *Processor, ctx context.Context, t Transform, input io.Reader, output io.Writer) error
+
+// Engines is the registry of the image processing engines by name (as used on OutputFormats)
+var Engines = map[string]Engine{
+	"Imagick": (*Processor).processImagick,
+	"Webp":    (*Processor).processWebp,
+}
+
+// Processor processes images with the engines registered for the output formats
+// Empty fields fall back to the package defaults (OutputFormats, Engines, ValidInputMimeTypes, Detector, Programs and logger)
+type Processor struct {
+	OutputFormats  map[string]string
+	Engines        map[string]Engine
+	InputMimeTypes map[string]bool
+	Detector       MimeTypeDetector
+	Programs       []string
+	Verbose        bool
+	Stdout         *log.Logger
+	Stderr         *log.Logger
+}
+
+// Process an image using a transformation to output a file
+func (p *Processor) Process(t Transform, input string, output string) (err error) {
+	return p.ProcessContext(context.Background(), t, input, output)
+}
+
+// ProcessContext processes an image using a transformation to output a file
+// The engine programs are killed if the context is done before they finish
+func (p *Processor) ProcessContext(ctx context.Context, t Transform, input string, output string) (err error) {
+	engine, valid := p.engine(t.Output)
+
+	if !valid {
+		return ErrOutputFormatNotSupported
+	}
+
+	mimeType, mimeErr := p.detector().TypeByFile(input)
+
+	if mimeErr != nil {
+		return ErrMimeTypeExtension
+	}
+
+	if !p.inputMimeTypes()[mimeType] {
+		return ErrMimeTypeNotSupported
+	}
+
+	in, err := os.Open(input)
+
+	if err != nil {
+		return err
+	}
+
+	defer in.Close()
+
+	out, err := os.Create(output)
+
+	if err != nil {
+		return err
+	}
+
+	if err = engine(p, ctx, t.ApplyDPR(), in, out); err != nil {
+		out.Close()
+		return err
+	}
+
+	return out.Close()
+}
+
+// ProcessStream processes an image read from input using a transformation, writing it to output as it is processed
+func (p *Processor) ProcessStream(ctx context.Context, t Transform, input io.Reader, output io.Writer) error {
+	_, err := p.processStream(ctx, t, input, output)
+	return err
+}
+
+func (p *Processor) processStream(ctx context.Context, t Transform, input io.Reader, output io.Writer) (mimeType string, err error) {
+	engine, valid := p.engine(t.Output)
+
+	if !valid {
+		return "", ErrOutputFormatNotSupported
+	}
+
+	in := bufio.NewReaderSize(input, SniffLength)
+
+	if mimeType, err = p.detectStream(in); err != nil {
+		return mimeType, err
+	}
+
+	if !p.inputMimeTypes()[mimeType] {
+		return mimeType, ErrMimeTypeNotSupported
+	}
+
+	// the engine is chosen by the detected type, as the extension of the path might not match it
+	if extension, ok := InputExtensions[mimeType]; ok {
+		t.Image.Extension = extension
+	}
+
+	return mimeType, engine(p, ctx, t.ApplyDPR(), in, output)
+}
+
+func (p *Processor) detectStream(in *bufio.Reader) (string, error) {
+	buf, err := in.Peek(SniffLength)
+
+	if err != nil && err != io.EOF {
+		return "", err
+	}
+
+	mimeType, err := p.detector().TypeByBuffer(buf)
+
+	if err != nil {
+		return "", ErrMimeTypeExtension
+	}
+
+	return mimeType, nil
+}
+
+func (p *Processor) engine(format string) (engine Engine, valid bool) {
+	formats := p.OutputFormats
+
+	if formats == nil {
+		formats = OutputFormats
+	}
+
+	engines := p.Engines
+
+	if engines == nil {
+		engines = Engines
+	}
+
+	engine, valid = engines[formats[strings.ToLower(format)]]
+	return engine, valid
+}
+
+func (p *Processor) inputMimeTypes() map[string]bool {
+	if p.InputMimeTypes == nil {
+		return ValidInputMimeTypes
+	}
+
+	return p.InputMimeTypes
+}
+
+func (p *Processor) detector() MimeTypeDetector {
+	if p.Detector == nil {
+		return Detector
+	}
+
+	return p.Detector
+}
+
+func (p *Processor) programs() []string {
+	if p.Programs == nil {
+		return Programs
+	}
+
+	return p.Programs
+}
+
+func (p *Processor) stdout() *log.Logger {
+	if p.Stdout == nil {
+		return logger.Stdout
+	}
+
+	return p.Stdout
+}
+
+func (p *Processor) stderr() *log.Logger {
+	if p.Stderr == nil {
+		return logger.Stderr
+	}
+
+	return p.Stderr
+}
@@ -0,0 +1,79 @@
+package image
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+)
+
+// Metadata of a processed image
+type Metadata struct {
+	InputType   string `json:"inputType"`
+	ContentType string `json:"contentType"`
+	Size        int64  `json:"size"`
+}
+
+// ProcessReader processes an image read from r using a transformation with the default processor
+func ProcessReader(ctx context.Context, r io.Reader, t Transform) (io.Reader, Metadata, error) {
+	p := &Processor{
+		Verbose: Verbose,
+	}
+
+	return p.ProcessReader(ctx, r, t)
+}
+
+// ProcessReader processes an image read from r using a transformation
+// The image is processed in memory, using temporary files only for the programs that require them
+// Errors are the Err* validation errors, *ProgramError or I/O errors
+func (p *Processor) ProcessReader(ctx context.Context, r io.Reader, t Transform) (io.Reader, Metadata, error) {
+	var m Metadata
+	var output bytes.Buffer
+	var err error
+
+	switch t.Raw {
+	case true:
+		m.InputType, err = p.copyRaw(r, &output)
+	default:
+		m.InputType, err = p.processStream(ctx, t, r, &output)
+	}
+
+	if err != nil {
+		return nil, m, err
+	}
+
+	m.ContentType = TypeByBuffer(output.Bytes())
+	m.Size = int64(output.Len())
+
+	return &output, m, nil
+}
+
+func (p *Processor) copyRaw(r io.Reader, output *bytes.Buffer) (string, error) {
+	if _, err := output.ReadFrom(r); err != nil {
+		return "", err
+	}
+
+	mimeType, err := p.detector().TypeByBuffer(output.Bytes())
+
+	if err != nil {
+		return "", ErrMimeTypeExtension
+	}
+
+	return mimeType, nil
+}
+
+func writeTempFile(r io.Reader) (string, error) {
+	file, err := ioutil.TempFile(TempDir, "picel")
+
+	if err != nil {
+		return "", err
+	}
+
+	_, err = io.Copy(file, r)
+
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+
+	return file.Name(), err
+}
@@ -0,0 +1,18 @@
+package image
+
+var ProcessReaderCases = []ProcessReaderProvider{
+	{"GIF89a", Transform{Output: "png"}, "\x89PNG\r\n\x1A\nGIF89a", Metadata{
+		InputType:   "image/gif",
+		ContentType: "image/png",
+		Size:        14,
+	}, nil},
+	{"GIF89a", Transform{Raw: true, Output: "gif"}, "GIF89a", Metadata{
+		InputType:   "image/gif",
+		ContentType: "image/gif",
+		Size:        6,
+	}, nil},
+	{"GIF89a", Transform{Output: "webp"}, "", Metadata{}, errEngineMock},
+	{"GIF89a", Transform{Output: "bmp"}, "", Metadata{}, ErrOutputFormatNotSupported},
+	{"not an image", Transform{Output: "png"}, "", Metadata{}, ErrMimeTypeNotSupported},
+	{"", Transform{Output: "png"}, "", Metadata{}, ErrMimeTypeNotSupported},
+}
@@ -0,0 +1,117 @@
+package image
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+var errEngineMock = errors.New("Engine mock failure")
+
+func copyEngine(p *Processor, ctx context.Context, t Transform, input io.Reader, output io.Writer) error {
+	if _, err := io.WriteString(output, "\x89PNG\r\n\x1A\n"); err != nil {
+		return err
+	}
+
+	_, err := io.Copy(output, input)
+	return err
+}
+
+func failEngine(p *Processor, ctx context.Context, t Transform, input io.Reader, output io.Writer) error {
+	return errEngineMock
+}
+
+type ProcessReaderProvider struct {
+	input   string
+	t       Transform
+	output  string
+	m       Metadata
+	wantErr error
+}
+
+func TestProcessReader(t *testing.T) {
+	t.Parallel()
+	p := &Processor{
+		OutputFormats: map[string]string{
+			"png":  "copy",
+			"webp": "fail",
+		},
+		Engines: map[string]Engine{
+			"copy": copyEngine,
+			"fail": failEngine,
+		},
+	}
+
+	for _, c := range ProcessReaderCases {
+		r, m, err := p.ProcessReader(context.Background(), strings.NewReader(c.input), c.t)
+
+		if err != c.wantErr {
+			t.Errorf("ProcessReader(%q, %+v) error == %v, want %v", c.input, c.t, err, c.wantErr)
+		}
+
+		if err != nil {
+			continue
+		}
+
+		var output bytes.Buffer
+		output.ReadFrom(r)
+
+		if output.String() != c.output || m != c.m {
+			t.Errorf("ProcessReader(%q, %+v) == %q, %+v, want %q, %+v", c.input, c.t, output.String(), m, c.output, c.m)
+		}
+	}
+}
+
+func TestProcessReaderProgramError(t *testing.T) {
+	t.Parallel()
+	p := &Processor{
+		Engines: map[string]Engine{
+			"Imagick": func(p *Processor, ctx context.Context, t Transform, input io.Reader, output io.Writer) error {
+				return p.callProgram(ctx, "picel-missing-program", nil, input, output)
+			},
+		},
+	}
+
+	transform := Transform{
+		Output: "jpg",
+	}
+
+	_, _, err := p.ProcessReader(context.Background(), strings.NewReader("GIF89a"), transform)
+
+	if e, ok := err.(*ProgramError); !ok || e.Program != "picel-missing-program" {
+		t.Errorf("ProcessReader() should fail with *ProgramError, got %v instead", err)
+	}
+}
+
+func TestProcessReaderDetectedExtension(t *testing.T) {
+	t.Parallel()
+	var extension string
+
+	p := &Processor{
+		Engines: map[string]Engine{
+			"Webp": func(p *Processor, ctx context.Context, t Transform, input io.Reader, output io.Writer) error {
+				extension = t.Extension
+				return nil
+			},
+		},
+	}
+
+	transform := Transform{
+		Image: Image{
+			ID:        "foo",
+			Extension: "jpg",
+		},
+		Output: "webp",
+	}
+
+	if _, _, err := p.ProcessReader(context.Background(), strings.NewReader("GIF89a"), transform); err != nil {
+		t.Errorf("ProcessReader() should not fail, got %v instead", err)
+	}
+
+	if extension != "gif" {
+		t.Errorf("Engine got extension %v, want gif (the detected type)", extension)
+	}
+}
@@ -0,0 +1,89 @@
+package image
+
+import (
+	"bytes"
+	"io"
+	"os"
+)
+
+const (
+	// SniffLength is the number of bytes used to detect the mime type of a file
+	SniffLength = 512
+
+	// MimeTypeEmpty is the mime type of empty files
+	MimeTypeEmpty = "application/x-empty"
+
+	// MimeTypeUnknown is the mime type of files that are not recognized
+	MimeTypeUnknown = "application/octet-stream"
+)
+
+// MimeTypeDetector detects the mime type of a file or of the content starting with a buffer
+type MimeTypeDetector interface {
+	TypeByFile(filename string) (string, error)
+	TypeByBuffer(buf []byte) (string, error)
+}
+
+type magicNumber struct {
+	offset   int
+	magic    []byte
+	mimeType string
+}
+
+var magicNumbers = []magicNumber{
+	{0, []byte("\xFF\xD8\xFF"), "image/jpeg"},
+	{0, []byte("\x89PNG\r\n\x1A\n"), "image/png"},
+	{0, []byte("GIF87a"), "image/gif"},
+	{0, []byte("GIF89a"), "image/gif"},
+	{8, []byte("WEBP"), "image/webp"},
+	{0, []byte("II*\x00"), "image/tiff"},
+	{0, []byte("MM\x00*"), "image/tiff"},
+	{0, []byte("BM"), "image/bmp"},
+	{0, []byte("%PDF-"), "application/pdf"},
+}
+
+// Sniffer detects the mime type of files by their magic numbers
+type Sniffer struct{}
+
+// TypeByFile returns the mime type of a file
+func (Sniffer) TypeByFile(filename string) (string, error) {
+	file, err := os.Open(filename)
+
+	if err != nil {
+		return "", err
+	}
+
+	defer file.Close()
+
+	buf := make([]byte, SniffLength)
+	n, err := io.ReadFull(file, buf)
+
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return "", err
+	}
+
+	return TypeByBuffer(buf[:n]), nil
+}
+
+// TypeByBuffer returns the mime type of the content starting with the given buffer
+func (Sniffer) TypeByBuffer(buf []byte) (string, error) {
+	return TypeByBuffer(buf), nil
+}
+
+// TypeByBuffer returns the mime type of the content starting with the given buffer
+func TypeByBuffer(buf []byte) string {
+	if len(buf) == 0 {
+		return MimeTypeEmpty
+	}
+
+	for _, m := range magicNumbers {
+		if len(buf) >= m.offset+len(m.magic) && bytes.Equal(buf[m.offset:m.offset+len(m.magic)], m.magic) {
+			if m.mimeType == "image/webp" && !bytes.HasPrefix(buf, []byte("RIFF")) {
+				continue
+			}
+
+			return m.mimeType
+		}
+	}
+
+	return MimeTypeUnknown
+}
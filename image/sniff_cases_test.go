@@ -0,0 +1,19 @@
+package image
+
+var TypeByBufferCases = []TypeByBufferProvider{
+	{"", MimeTypeEmpty},
+	{"\xFF\xD8\xFF\xE0\x00\x10JFIF\x00", "image/jpeg"},
+	{"\x89PNG\r\n\x1A\n\x00\x00\x00\rIHDR", "image/png"},
+	{"GIF87a\x01\x00\x01\x00", "image/gif"},
+	{"GIF89a\x01\x00\x01\x00", "image/gif"},
+	{"RIFF\x24\x00\x00\x00WEBPVP8 ", "image/webp"},
+	{"RIFF\x24\x00\x00\x00WAVEfmt ", MimeTypeUnknown},
+	{"XXXX\x24\x00\x00\x00WEBPVP8 ", MimeTypeUnknown},
+	{"II*\x00\x08\x00\x00\x00", "image/tiff"},
+	{"MM\x00*\x00\x00\x00\x08", "image/tiff"},
+	{"BM\x3A\x00\x00\x00", "image/bmp"},
+	{"%PDF-1.4\n", "application/pdf"},
+	{"\xFF\xD8", MimeTypeUnknown},
+	{"<svg></svg>", MimeTypeUnknown},
+	{"GIF", MimeTypeUnknown},
+}
@@ -0,0 +1,55 @@
+package image
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+type TypeByBufferProvider struct {
+	content  string
+	mimeType string
+}
+
+func TestTypeByBuffer(t *testing.T) {
+	t.Parallel()
+	for _, c := range TypeByBufferCases {
+		mimeType := TypeByBuffer([]byte(c.content))
+
+		if mimeType != c.mimeType {
+			t.Errorf("TypeByBuffer(%q) == %q, want %q", c.content, mimeType, c.mimeType)
+		}
+	}
+}
+
+func TestSnifferTypeByFile(t *testing.T) {
+	t.Parallel()
+	for _, c := range TypeByBufferCases {
+		file, err := ioutil.TempFile(os.TempDir(), "picel")
+
+		if err != nil {
+			panic(err)
+		}
+
+		defer os.Remove(file.Name())
+
+		if _, err = file.WriteString(c.content); err != nil {
+			panic(err)
+		}
+
+		file.Close()
+
+		mimeType, err := Sniffer{}.TypeByFile(file.Name())
+
+		if mimeType != c.mimeType || err != nil {
+			t.Errorf("TypeByFile(%q) == %q, %v, want %q, nil", c.content, mimeType, err, c.mimeType)
+		}
+	}
+}
+
+func TestSnifferTypeByFileNotFound(t *testing.T) {
+	t.Parallel()
+	if _, err := (Sniffer{}).TypeByFile("not-found"); !os.IsNotExist(err) {
+		t.Errorf("TypeByFile(%q) should fail with not exist error, got %v", "not-found", err)
+	}
+}
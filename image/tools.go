@@ -0,0 +1,76 @@
+package image
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// Programs used by the engines
+var Programs = []string{"convert", "cwebp", "gif2webp"}
+
+// Tool is a program used by the engines, with its version or the error running it
+type Tool struct {
+	Name    string `json:"name"`
+	Version string `json:"version,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+// ProgramVersion runs a program with -version, returning the first line of its output
+func ProgramVersion(ctx context.Context, name string) (string, error) {
+	out, err := exec.CommandContext(ctx, name, "-version").Output()
+
+	if err != nil {
+		return "", err
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" {
+			return line, nil
+		}
+	}
+
+	return "", nil
+}
+
+// Tools returns the versions of the programs used by the engines
+func (p *Processor) Tools(ctx context.Context) []Tool {
+	var tools []Tool
+
+	for _, name := range p.programs() {
+		tool := Tool{
+			Name: name,
+		}
+
+		version, err := ProgramVersion(ctx, name)
+
+		switch err {
+		case nil:
+			tool.Version = version
+		default:
+			tool.Error = err.Error()
+		}
+
+		tools = append(tools, tool)
+	}
+
+	return tools
+}
+
+// CheckTempDir checks if temporary files can be created on TempDir
+func CheckTempDir() error {
+	file, err := ioutil.TempFile(TempDir, "picel-check")
+
+	if err != nil {
+		return err
+	}
+
+	file.Close()
+	return os.Remove(file.Name())
+}
@@ -7,13 +7,21 @@ picel (picture element) is an image processing micro service.
 package main
 
 import (
+	"context"
+	"errors"
+	"expvar"
 	"flag"
 	"fmt"
+	"net"
 	"net/http"
+	"os"
 	"os/exec"
+	"os/signal"
 	"strings"
+	"syscall"
 	"time"
 
+	"github.com/henvic/picel/client"
 	"github.com/henvic/picel/image"
 	"github.com/henvic/picel/logger"
 	"github.com/henvic/picel/server"
@@ -29,14 +37,71 @@ var (
 	addr        string
 	verbose     bool
 	flagVersion bool
+	s3          client.S3
+	options     = server.Options{
+		MaxDownloadSize: server.DefaultMaxDownloadSize,
+		MaxUploadSize:   32 << 20,
+	}
+	circuits = &client.Circuits{}
+	mirrors  = mirrorsFlag{}
+	headers  = backendHeadersFlag{}
+	forward  listFlag
 )
 
+// ErrForwardWithoutBackend is returned when request headers are forwarded in the open mode,
+// where the request path chooses the host receiving them
+var ErrForwardWithoutBackend = errors.New("--forward-header requires --backend, --mirror or --s3-bucket")
+
 func init() {
+	flag.StringVar(&configFile, "config", "", "JSON configuration file, with the flags as keys (default: $PICEL_CONFIG)")
 	flag.StringVar(&addr, "addr", defaultAddr, "Serving address")
-	flag.StringVar(&server.Backend, "backend", defaultBackend, "Image storage back-end server")
-	flag.DurationVar(&server.DownloadTimeout, "downloadTimeout", 5*time.Second, "Timeout for downloading an image from the origin server")
+	flag.StringVar(&tlsCert, "tls-cert", "", "TLS certificate file for serving HTTPS and HTTP/2 (reloaded when changed)")
+	flag.StringVar(&tlsKey, "tls-key", "", "TLS key file for serving HTTPS and HTTP/2 (reloaded when changed)")
+	flag.StringVar(&redirectAddr, "redirect-addr", "", "Serving address for redirecting HTTP requests to HTTPS, such as :80")
+	flag.BoolVar(&h2c, "h2c", false, "Serve HTTP/2 without TLS (h2c) along with HTTP/1")
+	flag.DurationVar(&readTimeout, "read-timeout", 30*time.Second, "Maximum duration for reading a request, including the body (0 means no timeout)")
+	flag.DurationVar(&readHeaderTimeout, "read-header-timeout", 10*time.Second, "Maximum duration for reading the request headers (0 means no timeout)")
+	flag.DurationVar(&writeTimeout, "write-timeout", 60*time.Second, "Maximum duration for writing a response, including downloading and processing the image (0 means no timeout)")
+	flag.DurationVar(&idleTimeout, "idle-timeout", 120*time.Second, "Maximum duration a keep-alive connection waits for the next request (0 means no timeout)")
+	flag.DurationVar(&shutdownTimeout, "shutdown-timeout", 30*time.Second, "Time to drain the in-flight requests on SIGTERM before canceling them")
+	flag.StringVar(&options.Backend, "backend", defaultBackend, "Image storage back-end server (comma-separated list of mirrors tried in order)")
+	flag.Var(mirrors, "mirror", "Mirrors of a back-end server tried in order when it fails, as <backend>=<mirror>[,<mirror>...] (repeatable)")
+	flag.DurationVar(&options.HedgeAfter, "hedge-after", 0, "Latency after which a request to the next mirror is hedged (0 disables it)")
+	flag.Var((*byteSizeFlag)(&options.MaxDownloadSize), "max-download-size", "Maximum size of an image downloaded from the origin server, such as 20MB (0 means unlimited, which lets any client fill the memory)")
+	flag.BoolVar(&options.ClientHints, "client-hints", false, "Scale images by the DPR, Width and Save-Data client hints")
+	flag.BoolVar(&options.Uploads, "uploads", false, "Process images sent on POST and PUT requests")
+	flag.Var((*byteSizeFlag)(&options.MaxUploadSize), "max-upload-size", "Maximum size of an upload request body, such as 20MB (0 means unlimited)")
+	flag.StringVar(&options.ContentTypeCheck, "content-type-check", client.ContentTypeLenient, "Validation of the origin server Content-Type: strict, lenient (also accepts missing or generic binary types) or off")
+	flag.Var(&forward, "forward-header", "Request headers forwarded to the back-end server (comma-separated, repeatable)")
+	flag.Var(headers.kind("header"), "backend-header", "Header sent to a back-end server, as '<backend>=<name>: <value>' (repeatable, $VARS are expanded)")
+	flag.Var(headers.kind("basic"), "backend-basic-auth", "Basic authentication for a back-end server, as '<backend>=<username>:<password>' (repeatable, $VARS are expanded)")
+	flag.Var(headers.kind("bearer"), "backend-bearer-token", "Bearer token for a back-end server, as '<backend>=<token>' (repeatable, $VARS are expanded)")
+	flag.DurationVar(&options.Cache.MaxAge, "cache-max-age", 0, "Cache-Control max-age of the images (0 sends no Cache-Control)")
+	flag.DurationVar(&options.Cache.StaleWhileRevalidate, "cache-stale-while-revalidate", 0, "Cache-Control stale-while-revalidate of the images")
+	flag.BoolVar(&options.Cache.Immutable, "cache-immutable", false, "Mark the images as immutable on Cache-Control")
+	flag.StringVar(&options.Cache.Origin, "origin-cache", server.OriginCacheIgnore, "Use of the origin server cache headers: ignore (except for no-store and private), copy or stricter")
+	flag.DurationVar(&options.Cache.ErrorMaxAge, "error-cache-max-age", 10*time.Second, "Cache-Control max-age of client errors such as 404 Not Found (server errors are never cached)")
+	flag.DurationVar(&options.DownloadTimeout, "downloadTimeout", 5*time.Second, "Timeout for downloading an image from the origin server")
 	flag.BoolVar(&verbose, "verbose", false, "Pipe image processing output to stderr/stdout")
 	flag.BoolVar(&flagVersion, "version", false, "Print version information and quit")
+	flag.StringVar(&s3.Bucket, "s3-bucket", "", "S3 bucket to use as the image storage back-end server")
+	flag.StringVar(&s3.Region, "s3-region", "", "S3 region (default: $AWS_REGION or "+client.S3DefaultRegion+")")
+	flag.StringVar(&s3.Endpoint, "s3-endpoint", "", "S3-compatible endpoint (default: Amazon S3)")
+	flag.BoolVar(&s3.PathStyle, "s3-path-style", false, "Use path-style S3 URLs (endpoint/bucket/key)")
+	flag.IntVar(&options.Retry.Retries, "retries", 2, "Retries for transient failures when downloading an image from the origin server")
+	flag.DurationVar(&options.Retry.Backoff, "retry-backoff", 100*time.Millisecond, "Base delay between retries (exponential backoff with jitter)")
+	flag.DurationVar(&options.Retry.MaxBackoff, "retry-max-backoff", 2*time.Second, "Maximum delay between retries")
+	flag.IntVar(&circuits.Threshold, "circuit-threshold", 5, "Consecutive failures to open the circuit of an origin server (0 disables it)")
+	flag.DurationVar(&circuits.Cooldown, "circuit-cooldown", 30*time.Second, "Time an open circuit waits before trying the origin server again")
+}
+
+// commands of picel
+var commands = map[string]command{
+	"doctor":  doctorCommand,
+	"encode":  encodeCommand,
+	"decode":  decodeCommand,
+	"process": processCommand,
+	"warm":    warmCommand,
 }
 
 func showVersion() {
@@ -64,25 +129,240 @@ func checkMissingDependencies(arg ...string) {
 	}
 }
 
+// setupMirrors copies the mirrors to the options, so that reloading the flags doesn't change the options in use
+func setupMirrors() {
+	backends := strings.Split(options.Backend, ",")
+	options.Backend = backends[0]
+	options.Mirrors = map[string][]string{}
+
+	for backend, list := range mirrors {
+		options.Mirrors[backend] = append([]string{}, list...)
+	}
+
+	if len(backends) > 1 {
+		options.Mirrors[options.Backend] = append(options.Mirrors[options.Backend], backends[1:]...)
+	}
+}
+
+// setupHeaders copies the headers to the options, so that reloading the flags doesn't change the options in use
+func setupHeaders() {
+	options.ForwardHeaders = append([]string{}, forward...)
+	options.BackendHeaders = map[string]http.Header{}
+
+	for backend, h := range headers {
+		options.BackendHeaders[backend] = h.Clone()
+	}
+}
+
+func setupS3Backend() error {
+	if err := s3.Validate(); err != nil {
+		return err
+	}
+
+	options.Backend = s3.BaseURL()
+	options.Signer = &s3
+	return nil
+}
+
+func validateOptions() error {
+	if !client.IsValidContentTypeCheck(options.ContentTypeCheck) {
+		return fmt.Errorf("Invalid content type check mode: %v", options.ContentTypeCheck)
+	}
+
+	if !server.IsValidOriginCache(options.Cache.Origin) {
+		return fmt.Errorf("Invalid origin cache mode: %v", options.Cache.Origin)
+	}
+
+	return nil
+}
+
+// setupOptions validates the flags and sets up the backends of the options
+func setupOptions() error {
+	if err := validateOptions(); err != nil {
+		return err
+	}
+
+	setupMirrors()
+	setupHeaders()
+
+	if s3.Bucket != "" {
+		if err := setupS3Backend(); err != nil {
+			return err
+		}
+	}
+
+	if len(options.ForwardHeaders) != 0 && options.Backend == "" && len(options.Mirrors) == 0 {
+		return ErrForwardWithoutBackend
+	}
+
+	return nil
+}
+
+// handlers built from the options, replaced when reloading the configuration
+type handlers struct {
+	images reloadableHandler
+	status reloadableHandler
+	ready  reloadableHandler
+}
+
+// store the handlers for the given options
+func (h *handlers) store(o server.Options) {
+	h.images.Store(server.New(o))
+	h.status.Store(server.NewStatusHandler(o))
+	h.ready.Store(server.NewReadyHandler(o))
+}
+
+// reload the configuration, replacing the handlers of h
+func reload(h *handlers, commandLine map[string][]string) {
+	err := reloadConfig(flag.CommandLine, configFile, os.Environ(), commandLine)
+
+	if err == nil {
+		err = setupOptions()
+	}
+
+	if err != nil {
+		logger.Stderr.Println(fmt.Sprintf("Failed to reload the configuration: %v", err))
+		return
+	}
+
+	h.store(options)
+	logger.Stdout.Println("Configuration reloaded")
+}
+
 func main() {
 	flag.Parse()
 
-	image.Verbose = verbose
-	server.Verbose = verbose
+	commandLine := recordCommandLine(flag.CommandLine, os.Args[1:])
+
+	if configFile == "" {
+		configFile = os.Getenv(envName("config"))
+	}
+
+	if err := loadConfig(flag.CommandLine, configFile, os.Environ(), commandLine); err != nil {
+		logger.Stderr.Fatal(err)
+	}
+
+	options.Verbose = verbose
 
 	if flagVersion {
 		showVersion()
 		return
 	}
 
+	if flag.NArg() != 0 {
+		command, ok := commands[flag.Arg(0)]
+
+		if !ok {
+			logger.Stderr.Fatal(fmt.Sprintf("Unknown command: %v", flag.Arg(0)))
+		}
+
+		os.Exit(command(flag.Args()[1:], os.Stdin, os.Stdout, os.Stderr))
+	}
+
+	if err := validateTLSFlags(); err != nil {
+		logger.Stderr.Fatal(err)
+	}
+
+	if err := image.Init(); err != nil {
+		logger.Stderr.Fatal(err)
+	}
+
 	checkMissingDependencies("convert", "cwebp", "gif2webp")
 
+	s3.LoadEnv()
+
+	if err := setupOptions(); err != nil {
+		logger.Stderr.Fatal(err)
+	}
+
+	if s3.Bucket != "" {
+		logger.Stdout.Println(fmt.Sprintf("S3 backend mode: bucket %v", s3.Bucket))
+	}
+
+	tempDir, err := setupTempDir()
+
+	if err != nil {
+		logger.Stderr.Fatal(err)
+	}
+
+	ln, err := net.Listen("tcp", addr)
+
+	if err != nil {
+		os.RemoveAll(tempDir)
+		logger.Stderr.Fatal(err)
+	}
+
 	logger.Stdout.Println(fmt.Sprintf("picel started listening on %v", addr))
 
-	if server.Backend != "" {
-		logger.Stdout.Println(fmt.Sprintf("Single backend mode: %v", server.Backend))
+	if options.Backend != "" {
+		logger.Stdout.Println(fmt.Sprintf("Single backend mode: %v", options.Backend))
+	}
+
+	for backend, list := range mirrors {
+		logger.Stdout.Println(fmt.Sprintf("Mirrors for %v: %v", backend, strings.Join(list, ", ")))
+	}
+
+	expvar.Publish("picel.circuits", circuits)
+
+	options.Circuits = circuits
+
+	handler := &handlers{}
+	handler.store(options)
+	http.Handle("/statusz", &handler.status)
+	http.HandleFunc("/healthz", server.HealthHandler)
+	http.Handle("/readyz", &handler.ready)
+	http.Handle("/", &handler.images)
+
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+
+	go func() {
+		for range hup {
+			reload(handler, commandLine)
+		}
+	}()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	srv := newHTTPServer(ctx)
+
+	if err = setupTLS(srv); err != nil {
+		os.RemoveAll(tempDir)
+		logger.Stderr.Fatal(err)
+	}
+
+	var others []*http.Server
+
+	if redirectAddr != "" {
+		rln, err := net.Listen("tcp", redirectAddr)
+
+		if err != nil {
+			os.RemoveAll(tempDir)
+			logger.Stderr.Fatal(err)
+		}
+
+		redirect := &http.Server{
+			Handler:           redirectHandler(addr),
+			ReadHeaderTimeout: readHeaderTimeout,
+			IdleTimeout:       idleTimeout,
+		}
+
+		others = append(others, redirect)
+		go redirect.Serve(rln)
+
+		logger.Stdout.Println(fmt.Sprintf("Redirecting HTTP requests on %v to HTTPS", redirectAddr))
+	}
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, syscall.SIGTERM, os.Interrupt)
+
+	err = serve(srv, ln, stop, cancel, others...)
+	os.RemoveAll(tempDir)
+
+	if err != nil && err != http.ErrServerClosed {
+		logger.Stderr.Fatal(err)
 	}
 
-	http.HandleFunc("/", server.Handler)
-	panic(http.ListenAndServe(addr, nil))
+	logger.Stdout.Println("picel stopped")
 }
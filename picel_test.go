@@ -3,6 +3,7 @@ package main
 import (
 	"bytes"
 	"log"
+	"reflect"
 	"testing"
 
 	"github.com/henvic/picel/logger"
@@ -51,3 +52,58 @@ func TestCheckMissingDependencies(t *testing.T) {
 		}
 	}
 }
+
+func TestSetupMirrors(t *testing.T) {
+	defaultOptions := options
+	defaultMirrors := mirrors
+	options.Backend = "example.net,s:mirror1.example.net,mirror2.example.net"
+	mirrors = mirrorsFlag{}
+
+	setupMirrors()
+
+	backend, got := options.Backend, options.Mirrors
+	options = defaultOptions
+	mirrors = defaultMirrors
+
+	want := map[string][]string{
+		"example.net": {"s:mirror1.example.net", "mirror2.example.net"},
+	}
+
+	if backend != "example.net" || !reflect.DeepEqual(got, want) {
+		t.Errorf("setupMirrors() == %v, %v, want %v, %v", backend, got, "example.net", want)
+	}
+}
+
+func TestSetupOptionsForwardWithoutBackend(t *testing.T) {
+	// don't run in parallel due to mocking options, mirrors and forward
+	defaultOptions := options
+	defaultMirrors := mirrors
+	defaultForward := forward
+
+	defer func() {
+		options = defaultOptions
+		mirrors = defaultMirrors
+		forward = defaultForward
+	}()
+
+	mirrors = mirrorsFlag{}
+	forward = listFlag{"Cookie"}
+	options.Backend = ""
+
+	if err := setupOptions(); err != ErrForwardWithoutBackend {
+		t.Errorf("setupOptions() in the open mode should fail with %v, got %v instead", ErrForwardWithoutBackend, err)
+	}
+
+	options.Backend = "example.net"
+
+	if err := setupOptions(); err != nil {
+		t.Errorf("setupOptions() with a backend should not fail, got %v instead", err)
+	}
+
+	options.Backend = ""
+	mirrors = mirrorsFlag{"example.net": {"mirror.example.net"}}
+
+	if err := setupOptions(); err != nil {
+		t.Errorf("setupOptions() with mirrors should not fail, got %v instead", err)
+	}
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/henvic/picel/image"
+	"github.com/henvic/picel/logger"
+)
+
+var (
+	readTimeout       time.Duration
+	readHeaderTimeout time.Duration
+	writeTimeout      time.Duration
+	idleTimeout       time.Duration
+	shutdownTimeout   time.Duration
+)
+
+// newHTTPServer for the handlers on http.DefaultServeMux
+// The contexts of the requests derive from ctx, so canceling it stops the image processing programs
+func newHTTPServer(ctx context.Context) *http.Server {
+	return &http.Server{
+		ReadTimeout:       readTimeout,
+		ReadHeaderTimeout: readHeaderTimeout,
+		WriteTimeout:      writeTimeout,
+		IdleTimeout:       idleTimeout,
+		BaseContext: func(net.Listener) context.Context {
+			return ctx
+		},
+	}
+}
+
+// setupTempDir creates the directory for the temporary files of the image processing programs
+func setupTempDir() (string, error) {
+	dir, err := ioutil.TempDir("", "picel")
+
+	if err == nil {
+		image.TempDir = dir
+	}
+
+	return dir, err
+}
+
+// serve on ln until a signal is received on stop, then stop accepting connections and drain the in-flight requests
+// of srv and of the other servers (such as the HTTP to HTTPS redirect)
+// Requests still running after shutdownTimeout are canceled by calling cancel
+func serve(srv *http.Server, ln net.Listener, stop <-chan os.Signal, cancel context.CancelFunc, others ...*http.Server) error {
+	errs := make(chan error, 1)
+
+	go func() {
+		if srv.TLSConfig != nil {
+			errs <- srv.ServeTLS(ln, "", "")
+			return
+		}
+
+		errs <- srv.Serve(ln)
+	}()
+
+	select {
+	case err := <-errs:
+		return err
+	case sig := <-stop:
+		logger.Stdout.Println(fmt.Sprintf("Received %v, shutting down", sig))
+	}
+
+	ctx, cancelShutdown := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancelShutdown()
+
+	var wg sync.WaitGroup
+
+	for _, other := range others {
+		wg.Add(1)
+
+		go func(other *http.Server) {
+			defer wg.Done()
+
+			if err := other.Shutdown(ctx); err != nil {
+				other.Close()
+			}
+		}(other)
+	}
+
+	err := srv.Shutdown(ctx)
+	wg.Wait()
+
+	if err != context.DeadlineExceeded {
+		return err
+	}
+
+	logger.Stderr.Println("Shutdown timeout exceeded, canceling the in-flight requests")
+	cancel()
+	return srv.Close()
+}
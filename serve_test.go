@@ -0,0 +1,241 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/henvic/picel/image"
+)
+
+func startServe(t *testing.T, handler http.HandlerFunc, setup func(*http.Server) error) (url string, stop chan os.Signal, done chan error) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	srv := newHTTPServer(ctx)
+	srv.Handler = handler
+
+	if setup != nil {
+		if err := setup(srv); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// the URL is set before serving, as serving changes the TLS configuration
+	url = "http://" + ln.Addr().String()
+
+	if srv.TLSConfig != nil {
+		url = "https://" + ln.Addr().String()
+	}
+
+	stop = make(chan os.Signal, 1)
+	done = make(chan error, 1)
+
+	go func() {
+		done <- serve(srv, ln, stop, cancel)
+	}()
+
+	return url, stop, done
+}
+
+func TestServeDrainsRequests(t *testing.T) {
+	// don't run in parallel due to mocking shutdownTimeout
+	defaultShutdownTimeout := shutdownTimeout
+	shutdownTimeout = 5 * time.Second
+
+	defer func() {
+		shutdownTimeout = defaultShutdownTimeout
+	}()
+
+	started := make(chan bool)
+
+	url, stop, done := startServe(t, func(w http.ResponseWriter, r *http.Request) {
+		started <- true
+		time.Sleep(100 * time.Millisecond)
+		w.Write([]byte("ok"))
+	}, nil)
+
+	type result struct {
+		body string
+		err  error
+	}
+
+	responses := make(chan result, 1)
+
+	go func() {
+		resp, err := http.Get(url)
+
+		if err != nil {
+			responses <- result{err: err}
+			return
+		}
+
+		defer resp.Body.Close()
+		body, err := ioutil.ReadAll(resp.Body)
+		responses <- result{string(body), err}
+	}()
+
+	<-started
+	stop <- syscall.SIGTERM
+
+	if r := <-responses; r.body != "ok" || r.err != nil {
+		t.Errorf("In-flight request should be drained, got %q, %v instead", r.body, r.err)
+	}
+
+	if err := <-done; err != nil {
+		t.Errorf("serve() should stop without errors, got %v instead", err)
+	}
+}
+
+func TestServeCancelsRequestsAfterShutdownTimeout(t *testing.T) {
+	// don't run in parallel due to mocking shutdownTimeout
+	defaultShutdownTimeout := shutdownTimeout
+	shutdownTimeout = 50 * time.Millisecond
+
+	defer func() {
+		shutdownTimeout = defaultShutdownTimeout
+	}()
+
+	started := make(chan bool)
+	canceled := make(chan bool, 1)
+
+	url, stop, done := startServe(t, func(w http.ResponseWriter, r *http.Request) {
+		started <- true
+
+		select {
+		case <-r.Context().Done():
+			canceled <- true
+		case <-time.After(5 * time.Second):
+			canceled <- false
+		}
+	}, nil)
+
+	go func() {
+		if resp, err := http.Get(url); err == nil {
+			resp.Body.Close()
+		}
+	}()
+
+	<-started
+	stop <- syscall.SIGTERM
+
+	if err := <-done; err != nil {
+		t.Errorf("serve() should stop without errors, got %v instead", err)
+	}
+
+	if !<-canceled {
+		t.Errorf("In-flight request should be canceled after the shutdown timeout")
+	}
+}
+
+func TestServeShutsDownOtherServers(t *testing.T) {
+	// don't run in parallel due to mocking shutdownTimeout
+	defaultShutdownTimeout := shutdownTimeout
+	shutdownTimeout = 5 * time.Second
+
+	defer func() {
+		shutdownTimeout = defaultShutdownTimeout
+	}()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rln, err := net.Listen("tcp", "127.0.0.1:0")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	started := make(chan bool)
+
+	redirect := &http.Server{
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			started <- true
+			time.Sleep(100 * time.Millisecond)
+			w.Write([]byte("redirect"))
+		}),
+	}
+
+	redirectDone := make(chan error, 1)
+
+	go func() {
+		redirectDone <- redirect.Serve(rln)
+	}()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	srv := newHTTPServer(ctx)
+	srv.Handler = http.NotFoundHandler()
+	stop := make(chan os.Signal, 1)
+	done := make(chan error, 1)
+
+	go func() {
+		done <- serve(srv, ln, stop, cancel, redirect)
+	}()
+
+	responses := make(chan string, 1)
+
+	go func() {
+		resp, err := http.Get("http://" + rln.Addr().String())
+
+		if err != nil {
+			responses <- err.Error()
+			return
+		}
+
+		defer resp.Body.Close()
+		body, _ := ioutil.ReadAll(resp.Body)
+		responses <- string(body)
+	}()
+
+	<-started
+	stop <- syscall.SIGTERM
+
+	if body := <-responses; body != "redirect" {
+		t.Errorf("In-flight request of the other server should be drained, got %q instead", body)
+	}
+
+	if err := <-done; err != nil {
+		t.Errorf("serve() should stop without errors, got %v instead", err)
+	}
+
+	if err := <-redirectDone; err != http.ErrServerClosed {
+		t.Errorf("Other server should be shut down, got %v instead", err)
+	}
+}
+
+func TestSetupTempDir(t *testing.T) {
+	// don't run in parallel due to mocking image.TempDir
+	defaultTempDir := image.TempDir
+
+	defer func() {
+		image.TempDir = defaultTempDir
+	}()
+
+	dir, err := setupTempDir()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+		t.Errorf("Temporary directory %v should exist, got %v instead", dir, err)
+	}
+
+	if image.TempDir != dir {
+		t.Errorf("image.TempDir == %v, want %v", image.TempDir, dir)
+	}
+}
@@ -0,0 +1,166 @@
+package server
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/henvic/picel/client"
+	"github.com/henvic/picel/image"
+)
+
+// normalizeBackend returns a backend as a URL without trailing slash
+func normalizeBackend(backend string) string {
+	return strings.TrimSuffix(expandHost(compressHost(backend)), "/")
+}
+
+// getSources returns the source URL followed by the URLs of the source on its mirrors
+// The backend with the longest prefix matching the source is used when backends overlap
+func (s *server) getSources(source string) []string {
+	var prefix string
+	var mirrors []string
+
+	for backend, m := range s.Mirrors {
+		p := normalizeBackend(backend)
+
+		if strings.HasPrefix(source, p+"/") && len(p) > len(prefix) {
+			prefix, mirrors = p, m
+		}
+	}
+
+	sources := []string{source}
+
+	for _, mirror := range mirrors {
+		sources = append(sources, normalizeBackend(mirror)+source[len(prefix):])
+	}
+
+	return sources
+}
+
+// backendHosts returns the hosts of the single backend and of the backends with mirrors
+func (s *server) backendHosts() map[string]bool {
+	hosts := map[string]bool{}
+
+	add := func(backend string) {
+		if u, err := url.Parse(normalizeBackend(backend)); err == nil && u.Host != "" {
+			hosts[u.Host] = true
+		}
+	}
+
+	if s.Backend != "" {
+		add(s.Backend)
+	}
+
+	for backend, mirrors := range s.Mirrors {
+		add(backend)
+
+		for _, mirror := range mirrors {
+			add(mirror)
+		}
+	}
+
+	return hosts
+}
+
+func (s *server) logSource(t image.Transform, download *client.Download, err error) {
+	served := download.Metadata.Source
+
+	switch {
+	case err != nil && len(download.Mirrors) != 0:
+		s.stderr().Println(fmt.Sprintf("All backends failed for %v: %v", t.Image.Source, err))
+	case err == nil && served != "" && served != download.URL:
+		s.stderr().Println(fmt.Sprintf("Backend failover: %v served by %v", t.Image.Source, served))
+	case err == nil && s.Verbose:
+		s.stdout().Println(fmt.Sprintf("Source %v served by %v", t.Image.Source, served))
+	}
+}
+
+func (s *server) getForwardedHeader(r *http.Request) http.Header {
+	h := http.Header{}
+
+	for _, name := range s.ForwardHeaders {
+		name = http.CanonicalHeaderKey(name)
+
+		if values, ok := r.Header[name]; ok && !client.HopByHopHeaders[name] {
+			h[name] = values
+		}
+	}
+
+	return h
+}
+
+// getBackendHeaders returns the headers sent to each backend host: the forwarded request headers,
+// which are only sent to the configured backends and mirrors, and the static backend headers
+func (s *server) getBackendHeaders(r *http.Request) map[string]http.Header {
+	headers := map[string]http.Header{}
+
+	if forwarded := s.getForwardedHeader(r); len(forwarded) != 0 {
+		for host := range s.backendHosts() {
+			headers[host] = forwarded.Clone()
+		}
+	}
+
+	for backend, h := range s.BackendHeaders {
+		u, err := url.Parse(normalizeBackend(backend))
+
+		if err != nil {
+			continue
+		}
+
+		if headers[u.Host] == nil {
+			headers[u.Host] = http.Header{}
+		}
+
+		for name, values := range h {
+			headers[u.Host][name] = values
+		}
+	}
+
+	return headers
+}
+
+// getExplainHeaders returns the names of the headers sent to the backend of the source (values are kept secret)
+func (s *server) getExplainHeaders(source string, r *http.Request) []string {
+	var h http.Header
+
+	if u, err := url.Parse(source); err == nil {
+		h = s.getBackendHeaders(r)[u.Host]
+	}
+
+	return client.HeaderNames(h)
+}
+
+// explainSource loads the source image to tell which backend served it
+func (s *server) explainSource(t image.Transform, r *http.Request) *SourceExplain {
+	var source bytes.Buffer
+	download, err := s.load(t, &source, r)
+
+	se := &SourceExplain{
+		Metadata: download.Metadata,
+	}
+
+	if err != nil {
+		se.Error = fmt.Sprintf("%v", err)
+	}
+
+	return se
+}
+
+func (s *server) explainHandler(path string, t image.Transform, errs []error, err error, w http.ResponseWriter, r *http.Request) {
+	e := buildExplain(path, t, err, errs)
+
+	if sources := s.getSources(t.Image.Source); len(sources) > 1 {
+		e.Backends = sources
+	}
+
+	e.BackendHeaders = s.getExplainHeaders(t.Image.Source, r)
+
+	if err == nil && r.URL.Query().Get("explain") == "fetch" {
+		e.Source = s.explainSource(t, r)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	fmt.Fprint(w, jsonEncodeExplain(e))
+}
@@ -0,0 +1,182 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"strconv"
+	"strings"
+
+	"github.com/henvic/picel/image"
+)
+
+// MaxBatchRenditions is the maximum number of renditions of a batch request
+const MaxBatchRenditions = 32
+
+var (
+	// ErrBatchEmpty is returned when a batch request has no renditions
+	ErrBatchEmpty = errors.New("Missing renditions")
+
+	// ErrBatchTooLarge is returned when a batch request has more than MaxBatchRenditions renditions
+	ErrBatchTooLarge = fmt.Errorf("Batch exceeds the maximum of %d renditions", MaxBatchRenditions)
+)
+
+// batchRequest is a source with the transformations to apply to it
+type batchRequest struct {
+	Backend    string        `json:"backend"`
+	Path       string        `json:"path"`
+	Renditions []publicImage `json:"renditions"`
+}
+
+// BatchItem is the result of a rendition of a batch request
+type BatchItem struct {
+	Path        string `json:"path"`
+	Status      int    `json:"status"`
+	ContentType string `json:"contentType,omitempty"`
+	Size        int    `json:"size"`
+	Data        []byte `json:"data,omitempty"`
+	Error       string `json:"error,omitempty"`
+}
+
+// BatchManifest is the JSON response of a batch request
+type BatchManifest struct {
+	Source string      `json:"source"`
+	Items  []BatchItem `json:"items"`
+}
+
+func (s *server) prepareBatch(r *http.Request) (transforms []image.Transform, paths []string, err error) {
+	var b batchRequest
+
+	if err = json.NewDecoder(r.Body).Decode(&b); err != nil {
+		return nil, nil, err
+	}
+
+	switch {
+	case len(b.Renditions) == 0:
+		return nil, nil, ErrBatchEmpty
+	case len(b.Renditions) > MaxBatchRenditions:
+		return nil, nil, ErrBatchTooLarge
+	}
+
+	for _, pi := range b.Renditions {
+		pi.Backend, pi.Path = b.Backend, b.Path
+		t, decodeErr := s.decodePublicImage(pi, r)
+
+		if decodeErr != nil {
+			return nil, nil, decodeErr
+		}
+
+		if len(transforms) != 0 && t.Image.Source != transforms[0].Image.Source {
+			return nil, nil, errors.New("Renditions must have the same source")
+		}
+
+		transforms = append(transforms, t)
+		paths = append(paths, "/"+s.publicPath(t))
+	}
+
+	return transforms, paths, nil
+}
+
+func (s *server) render(source *bytes.Buffer, t image.Transform, path string, r *http.Request) BatchItem {
+	var output bytes.Buffer
+	var err error
+
+	item := BatchItem{
+		Path:   path,
+		Status: http.StatusOK,
+	}
+
+	switch t.Raw {
+	case true:
+		_, err = output.Write(source.Bytes())
+		item.ContentType = image.TypeByBuffer(source.Bytes())
+	default:
+		err = s.Processor.ProcessStream(r.Context(), t, bytes.NewReader(source.Bytes()), &output)
+		item.ContentType = image.OutputContentTypes[strings.ToLower(t.Output)]
+	}
+
+	if err != nil {
+		s.stderr().Println(fmt.Sprintf("Processing error for %v: %v", path, err))
+
+		return BatchItem{
+			Path:   path,
+			Status: http.StatusInternalServerError,
+			Error:  "Processing error.",
+		}
+	}
+
+	item.Data = output.Bytes()
+	item.Size = output.Len()
+	return item
+}
+
+func writeBatchManifest(source string, items []BatchItem, w http.ResponseWriter) {
+	res, _ := json.MarshalIndent(BatchManifest{
+		Source: source,
+		Items:  items,
+	}, "", "    ")
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(res)
+}
+
+func writeBatchMultipart(items []BatchItem, w http.ResponseWriter) {
+	mw := multipart.NewWriter(w)
+	w.Header().Set("Content-Type", "multipart/mixed; boundary="+mw.Boundary())
+
+	for _, item := range items {
+		h := textproto.MIMEHeader{}
+		h.Set("Content-Location", item.Path)
+		h.Set("X-Picel-Status", strconv.Itoa(item.Status))
+
+		data := item.Data
+
+		switch item.Error {
+		case "":
+			h.Set("Content-Type", item.ContentType)
+		default:
+			h.Set("Content-Type", "text/plain; charset=utf-8")
+			data = []byte(item.Error + "\n")
+		}
+
+		part, _ := mw.CreatePart(h)
+		part.Write(data)
+	}
+
+	mw.Close()
+}
+
+// batchHandler renders multiple transformations of a source, downloading it only once
+// The renditions are returned as multipart/mixed, or as a JSON manifest on ?batch=json
+func (s *server) batchHandler(w http.ResponseWriter, r *http.Request) {
+	transforms, paths, err := s.prepareBatch(r)
+
+	if err != nil {
+		http.Error(w, "Bad request.", http.StatusBadRequest)
+		return
+	}
+
+	var source bytes.Buffer
+
+	if _, err = s.load(transforms[0], &source, r); err != nil {
+		downloadErrorHandler(err, w, r)
+		return
+	}
+
+	var items []BatchItem
+
+	for i, t := range transforms {
+		items = append(items, s.render(&source, t, paths[i], r))
+	}
+
+	if r.URL.Query().Get("batch") == "json" {
+		writeBatchManifest(transforms[0].Image.Source, items, w)
+		return
+	}
+
+	writeBatchMultipart(items, w)
+}
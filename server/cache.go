@@ -0,0 +1,290 @@
+package server
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/henvic/picel/client"
+	"github.com/henvic/picel/image"
+)
+
+const (
+	// OriginCacheIgnore uses the cache policy regardless of the origin cache headers, except for no-store and private
+	OriginCacheIgnore = "ignore"
+
+	// OriginCacheCopy carries the Cache-Control, Expires and Last-Modified of the origin over,
+	// using the cache policy when the origin has neither Cache-Control nor Expires
+	OriginCacheCopy = "copy"
+
+	// OriginCacheStricter uses the shorter lifetime of the origin and the cache policy
+	OriginCacheStricter = "stricter"
+)
+
+// CachePolicy is the Cache-Control policy of the image responses
+type CachePolicy struct {
+	// MaxAge of the renditions (no Cache-Control is sent when zero)
+	MaxAge time.Duration
+
+	// StaleWhileRevalidate is how long caches may serve a stale rendition while revalidating it
+	StaleWhileRevalidate time.Duration
+
+	// Immutable tells caches a fresh rendition never changes
+	Immutable bool
+
+	// ErrorMaxAge of the client error responses, such as 404 Not Found
+	// Server errors, and client errors when zero, are sent with no-store
+	ErrorMaxAge time.Duration
+
+	// Origin is how the cache headers of the origin are used (default: OriginCacheIgnore)
+	Origin string
+
+	// private scope for the responses, as they depend on the forwarded credentials
+	private bool
+}
+
+// credentialHeaders are the request headers making the responses private when forwarded to the backend
+var credentialHeaders = []string{"Authorization", "Cookie"}
+
+// forwardsCredentials tells if the credentials of the client are forwarded to the backend
+func forwardsCredentials(forwardHeaders []string) bool {
+	for _, name := range forwardHeaders {
+		for _, credential := range credentialHeaders {
+			if http.CanonicalHeaderKey(name) == credential {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// IsValidOriginCache tells if an origin cache mode is valid
+func IsValidOriginCache(mode string) bool {
+	return mode == "" || mode == OriginCacheIgnore || mode == OriginCacheCopy || mode == OriginCacheStricter
+}
+
+func seconds(d time.Duration) string {
+	return strconv.FormatInt(int64(d/time.Second), 10)
+}
+
+// cacheControl of the renditions, with the public or private scope
+func (c CachePolicy) cacheControl(scope string) string {
+	if c.MaxAge <= 0 {
+		return ""
+	}
+
+	directives := []string{scope, "max-age=" + seconds(c.MaxAge)}
+
+	if c.StaleWhileRevalidate > 0 {
+		directives = append(directives, "stale-while-revalidate="+seconds(c.StaleWhileRevalidate))
+	}
+
+	if c.Immutable {
+		directives = append(directives, "immutable")
+	}
+
+	return strings.Join(directives, ", ")
+}
+
+// parseCacheControl returns the directives of a Cache-Control header, with lowercase names
+func parseCacheControl(cc string) map[string]string {
+	directives := map[string]string{}
+
+	for _, directive := range strings.Split(cc, ",") {
+		name, value := directive, ""
+
+		if i := strings.Index(directive, "="); i != -1 {
+			name, value = directive[:i], strings.Trim(strings.TrimSpace(directive[i+1:]), `"`)
+		}
+
+		if name = strings.ToLower(strings.TrimSpace(name)); name != "" {
+			directives[name] = value
+		}
+	}
+
+	return directives
+}
+
+// privateCacheControl replaces the public scope of a Cache-Control header with the private one
+// s-maxage is dropped as well, as it only applies to shared caches
+func privateCacheControl(cc string) string {
+	directives := []string{"private"}
+
+	for _, directive := range strings.Split(cc, ",") {
+		directive = strings.TrimSpace(directive)
+		name := strings.ToLower(strings.TrimSpace(strings.SplitN(directive, "=", 2)[0]))
+
+		if name != "" && name != "public" && name != "private" && name != "s-maxage" {
+			directives = append(directives, directive)
+		}
+	}
+
+	return strings.Join(directives, ", ")
+}
+
+// originLifetime of a source for shared caches, from s-maxage, max-age or Expires
+func originLifetime(directives map[string]string, expires time.Time, now time.Time) (time.Duration, bool) {
+	for _, name := range []string{"s-maxage", "max-age"} {
+		if value, ok := directives[name]; ok {
+			age, err := strconv.ParseInt(value, 10, 64)
+
+			if err != nil || age < 0 {
+				return 0, true
+			}
+
+			return time.Duration(age) * time.Second, true
+		}
+	}
+
+	if !expires.IsZero() {
+		return expires.Sub(now), true
+	}
+
+	return 0, false
+}
+
+// stricter returns the policy with the shorter lifetime of the origin and the policy
+// The rendition is only immutable when the origin says so too
+func (c CachePolicy) stricter(directives map[string]string, expires time.Time, now time.Time) CachePolicy {
+	lifetime, ok := originLifetime(directives, expires, now)
+
+	if !ok {
+		return c
+	}
+
+	if c.MaxAge <= 0 || lifetime < c.MaxAge {
+		c.MaxAge = lifetime
+	}
+
+	if swr, err := strconv.ParseInt(directives["stale-while-revalidate"], 10, 64); err == nil && time.Duration(swr)*time.Second < c.StaleWhileRevalidate {
+		c.StaleWhileRevalidate = time.Duration(swr) * time.Second
+	}
+
+	if _, immutable := directives["immutable"]; !immutable {
+		c.Immutable = false
+	}
+
+	return c
+}
+
+// setCacheHeaders of a rendition of a source with the given metadata
+// no-store and private on the origin Cache-Control are always honored
+func (c CachePolicy) setCacheHeaders(h http.Header, m client.Metadata, now time.Time) {
+	directives := parseCacheControl(m.CacheControl)
+	_, noStore := directives["no-store"]
+	_, noCache := directives["no-cache"]
+	_, private := directives["private"]
+
+	scope := "public"
+
+	if private || c.private {
+		scope = "private"
+	}
+
+	cc := c.cacheControl(scope)
+
+	switch {
+	case noStore:
+		cc = "no-store"
+	case c.Origin == OriginCacheCopy && (m.CacheControl != "" || !m.Expires.IsZero()):
+		cc = m.CacheControl
+
+		if c.private {
+			cc = privateCacheControl(cc)
+		}
+	case c.Origin == OriginCacheStricter && noCache:
+		cc = scope + ", no-cache"
+	case c.Origin == OriginCacheStricter:
+		if p := c.stricter(directives, m.Expires, now); p.MaxAge > 0 || c.MaxAge > 0 {
+			cc = p.cacheControl(scope)
+
+			if p.MaxAge <= 0 {
+				cc = scope + ", no-cache"
+			}
+		}
+	}
+
+	if cc == "" && scope == "private" {
+		cc = scope
+	}
+
+	if cc != "" {
+		h.Set("Cache-Control", cc)
+	}
+
+	if c.Origin != OriginCacheCopy || noStore {
+		return
+	}
+
+	if !m.Expires.IsZero() {
+		h.Set("Expires", m.Expires.UTC().Format(http.TimeFormat))
+	}
+
+	if !m.LastModified.IsZero() {
+		h.Set("Last-Modified", m.LastModified.UTC().Format(http.TimeFormat))
+	}
+}
+
+// errorCacheControl of the error responses with the given status code
+func (c CachePolicy) errorCacheControl(code int) string {
+	if code >= http.StatusInternalServerError || c.ErrorMaxAge <= 0 {
+		return "no-store"
+	}
+
+	if c.private {
+		return "private, max-age=" + seconds(c.ErrorMaxAge)
+	}
+
+	return "public, max-age=" + seconds(c.ErrorMaxAge)
+}
+
+// cacheWriter replaces the caching headers of error responses
+type cacheWriter struct {
+	http.ResponseWriter
+	policy CachePolicy
+}
+
+func (cw *cacheWriter) WriteHeader(code int) {
+	if code >= http.StatusBadRequest {
+		cw.Header().Del("ETag")
+		cw.Header().Set("Cache-Control", cw.policy.errorCacheControl(code))
+	}
+
+	cw.ResponseWriter.WriteHeader(code)
+}
+
+// renditionETag derives a strong ETag from the source and the transformation
+// The source content is hashed when the backend has no ETag for it
+func renditionETag(sourceETag string, source []byte, t image.Transform) string {
+	if sourceETag == "" {
+		sourceETag = fmt.Sprintf("%x", sha256.Sum256(source))
+	}
+
+	sum := sha256.Sum256([]byte(strings.Join([]string{
+		sourceETag,
+		t.Image.Source,
+		image.Encode(t),
+		strconv.Itoa(t.Quality),
+	}, "\n")))
+
+	return fmt.Sprintf(`"%x"`, sum[:16])
+}
+
+// matchETag tells if an If-None-Match header matches an ETag, using the weak comparison
+func matchETag(ifNoneMatch string, etag string) bool {
+	if strings.TrimSpace(ifNoneMatch) == "*" {
+		return true
+	}
+
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		if strings.TrimPrefix(strings.TrimSpace(candidate), "W/") == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+	}
+
+	return false
+}
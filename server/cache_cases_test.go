@@ -0,0 +1,191 @@
+package server
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/henvic/picel/client"
+	"github.com/henvic/picel/image"
+)
+
+var testCachePolicy = CachePolicy{
+	MaxAge:               time.Hour,
+	StaleWhileRevalidate: time.Minute,
+	Immutable:            true,
+	ErrorMaxAge:          10 * time.Second,
+}
+
+var CacheControlCases = []CacheControlProvider{
+	{CachePolicy{}, ""},
+	{CachePolicy{MaxAge: time.Hour}, "public, max-age=3600"},
+	{CachePolicy{MaxAge: time.Hour, Immutable: true}, "public, max-age=3600, immutable"},
+	{testCachePolicy, "public, max-age=3600, stale-while-revalidate=60, immutable"},
+}
+
+var ForwardsCredentialsCases = []ForwardsCredentialsProvider{
+	{nil, false},
+	{[]string{"Accept-Language", "X-Request-Id"}, false},
+	{[]string{"Accept-Language", "authorization"}, true},
+	{[]string{"Cookie"}, true},
+}
+
+var ErrorCacheControlCases = []ErrorCacheControlProvider{
+	{CachePolicy{}, http.StatusNotFound, "no-store"},
+	{testCachePolicy, http.StatusNotFound, "public, max-age=10"},
+	{testCachePolicy, http.StatusBadRequest, "public, max-age=10"},
+	{testCachePolicy, http.StatusInternalServerError, "no-store"},
+	{testCachePolicy, http.StatusServiceUnavailable, "no-store"},
+	{CachePolicy{ErrorMaxAge: 10 * time.Second, private: true}, http.StatusNotFound, "private, max-age=10"},
+}
+
+var cacheNow = time.Date(2016, time.November, 3, 10, 0, 0, 0, time.UTC)
+
+var lastModified = time.Date(2016, time.November, 1, 10, 0, 0, 0, time.UTC)
+
+var SetCacheHeadersCases = []SetCacheHeadersProvider{
+	{CachePolicy{}, client.Metadata{}, "", "", ""},
+	{testCachePolicy, client.Metadata{}, "public, max-age=3600, stale-while-revalidate=60, immutable", "", ""},
+	{testCachePolicy, client.Metadata{CacheControl: "no-store"}, "no-store", "", ""},
+	{testCachePolicy, client.Metadata{CacheControl: "private, max-age=60"}, "private, max-age=3600, stale-while-revalidate=60, immutable", "", ""},
+	{CachePolicy{}, client.Metadata{CacheControl: "Private"}, "private", "", ""},
+	{CachePolicy{MaxAge: time.Hour, private: true}, client.Metadata{}, "private, max-age=3600", "", ""},
+	{CachePolicy{private: true}, client.Metadata{}, "private", "", ""},
+	{
+		CachePolicy{MaxAge: time.Hour, Origin: OriginCacheStricter, private: true},
+		client.Metadata{CacheControl: "public, max-age=60"},
+		"private, max-age=60", "", "",
+	},
+	{
+		CachePolicy{MaxAge: time.Hour, Origin: OriginCacheCopy},
+		client.Metadata{CacheControl: "public, max-age=60", LastModified: lastModified},
+		"public, max-age=60", "", "Tue, 01 Nov 2016 10:00:00 GMT",
+	},
+	{
+		CachePolicy{MaxAge: time.Hour, Origin: OriginCacheCopy, private: true},
+		client.Metadata{CacheControl: "public, max-age=60, s-maxage=600", LastModified: lastModified},
+		"private, max-age=60", "", "Tue, 01 Nov 2016 10:00:00 GMT",
+	},
+	{
+		CachePolicy{MaxAge: time.Hour, Origin: OriginCacheCopy, private: true},
+		client.Metadata{CacheControl: "max-age=60, immutable"},
+		"private, max-age=60, immutable", "", "",
+	},
+	{
+		CachePolicy{MaxAge: time.Hour, Origin: OriginCacheCopy, private: true},
+		client.Metadata{CacheControl: "Private, max-age=60"},
+		"private, max-age=60", "", "",
+	},
+	{
+		CachePolicy{MaxAge: time.Hour, Origin: OriginCacheCopy, private: true},
+		client.Metadata{Expires: cacheNow.Add(time.Minute)},
+		"private", "Thu, 03 Nov 2016 10:01:00 GMT", "",
+	},
+	{
+		CachePolicy{MaxAge: time.Hour, Origin: OriginCacheCopy},
+		client.Metadata{Expires: cacheNow.Add(time.Minute)},
+		"", "Thu, 03 Nov 2016 10:01:00 GMT", "",
+	},
+	{
+		CachePolicy{MaxAge: time.Hour, Origin: OriginCacheCopy},
+		client.Metadata{LastModified: lastModified},
+		"public, max-age=3600", "", "Tue, 01 Nov 2016 10:00:00 GMT",
+	},
+	{
+		CachePolicy{MaxAge: time.Hour, Origin: OriginCacheCopy},
+		client.Metadata{CacheControl: "no-store", LastModified: lastModified},
+		"no-store", "", "",
+	},
+	{
+		CachePolicy{MaxAge: time.Hour, Origin: OriginCacheStricter},
+		client.Metadata{CacheControl: "max-age=60"},
+		"public, max-age=60", "", "",
+	},
+	{
+		CachePolicy{MaxAge: time.Minute, Immutable: true, Origin: OriginCacheStricter},
+		client.Metadata{CacheControl: "max-age=3600, immutable"},
+		"public, max-age=60, immutable", "", "",
+	},
+	{
+		CachePolicy{MaxAge: time.Hour, Immutable: true, Origin: OriginCacheStricter},
+		client.Metadata{CacheControl: "max-age=600, s-maxage=300"},
+		"public, max-age=300", "", "",
+	},
+	{
+		CachePolicy{MaxAge: time.Hour, StaleWhileRevalidate: time.Hour, Origin: OriginCacheStricter},
+		client.Metadata{CacheControl: "private, max-age=600, stale-while-revalidate=30"},
+		"private, max-age=600, stale-while-revalidate=30", "", "",
+	},
+	{
+		CachePolicy{MaxAge: time.Hour, Origin: OriginCacheStricter},
+		client.Metadata{Expires: cacheNow.Add(2 * time.Minute)},
+		"public, max-age=120", "", "",
+	},
+	{
+		CachePolicy{MaxAge: time.Hour, Origin: OriginCacheStricter},
+		client.Metadata{Expires: time.Unix(0, 0)},
+		"public, no-cache", "", "",
+	},
+	{
+		CachePolicy{MaxAge: time.Hour, Origin: OriginCacheStricter},
+		client.Metadata{CacheControl: "no-cache"},
+		"public, no-cache", "", "",
+	},
+	{
+		CachePolicy{Origin: OriginCacheStricter},
+		client.Metadata{CacheControl: "max-age=60"},
+		"public, max-age=60", "", "",
+	},
+	{
+		CachePolicy{Origin: OriginCacheStricter},
+		client.Metadata{},
+		"", "", "",
+	},
+}
+
+var MatchETagCases = []MatchETagProvider{
+	{"", `"a"`, false},
+	{`"a"`, `"a"`, true},
+	{`W/"a"`, `"a"`, true},
+	{`"b", "a"`, `"a"`, true},
+	{`"b"`, `"a"`, false},
+	{"*", `"a"`, true},
+}
+
+var renditionTransform = image.Transform{
+	Image: image.Image{
+		ID:        "foo",
+		Extension: "jpg",
+		Source:    "http://example.net/foo.jpg",
+	},
+	Width:  100,
+	Output: "webp",
+}
+
+var RenditionETagCases = []RenditionETagProvider{
+	{`"a"`, "foo", renditionTransform, `"b"`, "foo", renditionTransform, false},
+	{"", "foo", renditionTransform, "", "bar", renditionTransform, false},
+	{`"a"`, "foo", renditionTransform, `"a"`, "bar", renditionTransform, true},
+	{`"a"`, "foo", renditionTransform, `"a"`, "foo", image.Transform{
+		Image:  renditionTransform.Image,
+		Width:  200,
+		Output: "webp",
+	}, false},
+	{`"a"`, "foo", renditionTransform, `"a"`, "foo", image.Transform{
+		Image:   renditionTransform.Image,
+		Width:   100,
+		Output:  "webp",
+		Quality: 60,
+	}, false},
+}
+
+var ServerCacheCases = []ServerCacheProvider{
+	{"/foo_gif.png", "", http.StatusOK, "public, max-age=3600, stale-while-revalidate=60, immutable", true},
+	{"/foo_gif.png", "ETAG", http.StatusNotModified, "public, max-age=3600, stale-while-revalidate=60, immutable", true},
+	{"/foo_gif.png", `"other", W/ETAG`, http.StatusNotModified, "public, max-age=3600, stale-while-revalidate=60, immutable", true},
+	{"/foo_gif.png", `"other"`, http.StatusOK, "public, max-age=3600, stale-while-revalidate=60, immutable", true},
+	{"/foo_raw.gif", "", http.StatusOK, "public, max-age=3600, stale-while-revalidate=60, immutable", true},
+	{"/private_gif.png", "", http.StatusOK, "private, max-age=3600, stale-while-revalidate=60, immutable", true},
+	{"/missing.png", "", http.StatusNotFound, "public, max-age=10", false},
+	{"/foo_gif.webp", "", http.StatusInternalServerError, "no-store", false},
+	{"/foo_@9x.png", "", http.StatusBadRequest, "public, max-age=10", false},
+}
@@ -0,0 +1,182 @@
+package server
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/henvic/picel/client"
+	"github.com/henvic/picel/image"
+)
+
+type CacheControlProvider struct {
+	policy CachePolicy
+	want   string
+}
+
+type ForwardsCredentialsProvider struct {
+	headers []string
+	want    bool
+}
+
+type ErrorCacheControlProvider struct {
+	policy CachePolicy
+	code   int
+	want   string
+}
+
+type SetCacheHeadersProvider struct {
+	policy       CachePolicy
+	metadata     client.Metadata
+	cacheControl string
+	expires      string
+	lastModified string
+}
+
+type MatchETagProvider struct {
+	ifNoneMatch string
+	etag        string
+	want        bool
+}
+
+type RenditionETagProvider struct {
+	etag1   string
+	source1 string
+	t1      image.Transform
+	etag2   string
+	source2 string
+	t2      image.Transform
+	same    bool
+}
+
+type ServerCacheProvider struct {
+	url          string
+	ifNoneMatch  string
+	code         int
+	cacheControl string
+	etag         bool
+}
+
+func TestCacheControl(t *testing.T) {
+	t.Parallel()
+	for _, c := range CacheControlCases {
+		if got := c.policy.cacheControl("public"); got != c.want {
+			t.Errorf("%+v.cacheControl(public) == %q, want %q", c.policy, got, c.want)
+		}
+	}
+}
+
+func TestForwardsCredentials(t *testing.T) {
+	t.Parallel()
+	for _, c := range ForwardsCredentialsCases {
+		if got := forwardsCredentials(c.headers); got != c.want {
+			t.Errorf("forwardsCredentials(%v) == %v, want %v", c.headers, got, c.want)
+		}
+	}
+}
+
+func TestErrorCacheControl(t *testing.T) {
+	t.Parallel()
+	for _, c := range ErrorCacheControlCases {
+		if got := c.policy.errorCacheControl(c.code); got != c.want {
+			t.Errorf("%+v.errorCacheControl(%d) == %q, want %q", c.policy, c.code, got, c.want)
+		}
+	}
+}
+
+func TestSetCacheHeaders(t *testing.T) {
+	t.Parallel()
+	for _, c := range SetCacheHeadersCases {
+		h := http.Header{}
+		c.policy.setCacheHeaders(h, c.metadata, cacheNow)
+
+		if h.Get("Cache-Control") != c.cacheControl || h.Get("Expires") != c.expires || h.Get("Last-Modified") != c.lastModified {
+			t.Errorf("%+v.setCacheHeaders for %+v == %v, want Cache-Control %q, Expires %q and Last-Modified %q",
+				c.policy, c.metadata, h, c.cacheControl, c.expires, c.lastModified)
+		}
+	}
+}
+
+func TestMatchETag(t *testing.T) {
+	t.Parallel()
+	for _, c := range MatchETagCases {
+		if got := matchETag(c.ifNoneMatch, c.etag); got != c.want {
+			t.Errorf("matchETag(%q, %q) == %v, want %v", c.ifNoneMatch, c.etag, got, c.want)
+		}
+	}
+}
+
+func TestRenditionETag(t *testing.T) {
+	t.Parallel()
+	for _, c := range RenditionETagCases {
+		etag1 := renditionETag(c.etag1, []byte(c.source1), c.t1)
+		etag2 := renditionETag(c.etag2, []byte(c.source2), c.t2)
+
+		if (etag1 == etag2) != c.same {
+			t.Errorf("renditionETag for %+v and %+v are %v and %v, same should be %v", c.t1, c.t2, etag1, etag2, c.same)
+		}
+	}
+}
+
+func TestServerCache(t *testing.T) {
+	t.Parallel()
+	fetcher := &client.Memory{}
+	fetcher.Put("http://example.net/foo.gif", []byte("GIF89a"), "image/gif")
+	fetcher.PutMetadata("http://example.net/private.gif", []byte("GIF89a"), client.Metadata{
+		ContentType:  "image/gif",
+		CacheControl: "private, max-age=60",
+	})
+
+	s := New(Options{
+		Backend: "http://example.net",
+		Fetcher: fetcher,
+		Cache:   testCachePolicy,
+		Processor: &image.Processor{
+			Engines: map[string]image.Engine{
+				"Imagick": func(p *image.Processor, ctx context.Context, t image.Transform, input io.Reader, output io.Writer) error {
+					_, err := io.Copy(output, input)
+					return err
+				},
+				"Webp": func(p *image.Processor, ctx context.Context, t image.Transform, input io.Reader, output io.Writer) error {
+					return &image.ProgramError{Program: "cwebp"}
+				},
+			},
+		},
+	})
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/foo_gif.png", nil)
+	s.ServeHTTP(w, req)
+	etag := w.Header().Get("ETag")
+
+	for _, c := range ServerCacheCases {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", c.url, nil)
+
+		if c.ifNoneMatch != "" {
+			req.Header.Set("If-None-Match", strings.Replace(c.ifNoneMatch, "ETAG", etag, -1))
+		}
+
+		s.ServeHTTP(w, req)
+
+		if w.Code != c.code || w.Header().Get("Cache-Control") != c.cacheControl {
+			t.Errorf("Request to %v with If-None-Match %q returned %v with Cache-Control %q, want %v with %q",
+				c.url, c.ifNoneMatch, w.Code, w.Header().Get("Cache-Control"), c.code, c.cacheControl)
+		}
+
+		if (w.Header().Get("ETag") != "") != c.etag {
+			t.Errorf("Request to %v returned ETag %q, ETag expected: %v", c.url, w.Header().Get("ETag"), c.etag)
+		}
+
+		if w.Code == http.StatusNotModified && w.Body.Len() != 0 {
+			t.Errorf("Not modified response for %v should have no body, got %q", c.url, w.Body.String())
+		}
+	}
+
+	if etag == "" || !strings.HasPrefix(etag, `"`) {
+		t.Errorf("ETag %q should be a strong ETag", etag)
+	}
+}
@@ -0,0 +1,103 @@
+package server
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/henvic/picel/image"
+)
+
+const (
+	// MaxDPR is the maximum device pixel ratio applied from the client hints
+	MaxDPR = image.MaxDPR
+
+	// SaveDataQuality is the output quality when the client asks to save data
+	SaveDataQuality = 60
+
+	acceptClientHints = "Sec-CH-DPR, Sec-CH-Width, Sec-CH-Viewport-Width"
+)
+
+// clientHintsVary are the request headers that change the response when client hints are enabled
+var clientHintsVary = []string{"Sec-CH-DPR", "Sec-CH-Width", "Sec-CH-Viewport-Width", "DPR", "Width", "Viewport-Width", "Save-Data"}
+
+// getHint returns the first client hint found, trying the legacy names after the Sec-CH- ones
+func getHint(r *http.Request, names ...string) string {
+	for _, name := range names {
+		if v := strings.TrimSpace(r.Header.Get(name)); v != "" {
+			return v
+		}
+	}
+
+	return ""
+}
+
+func getDPR(r *http.Request) float64 {
+	dpr, err := strconv.ParseFloat(getHint(r, "Sec-CH-DPR", "DPR"), 64)
+
+	switch {
+	case err != nil || math.IsNaN(dpr) || math.IsInf(dpr, 0) || dpr <= 0:
+		return 1
+	case dpr > MaxDPR:
+		return MaxDPR
+	}
+
+	return dpr
+}
+
+// getMaxWidth returns the width of the image on the client in physical pixels, or zero if unknown
+func getMaxWidth(r *http.Request, dpr float64) int {
+	if w, err := strconv.Atoi(getHint(r, "Sec-CH-Width", "Width")); err == nil && w > 0 {
+		return w
+	}
+
+	if vw, err := strconv.Atoi(getHint(r, "Sec-CH-Viewport-Width", "Viewport-Width")); err == nil && vw > 0 {
+		return scale(vw, dpr)
+	}
+
+	return 0
+}
+
+func isSaveData(r *http.Request) bool {
+	return strings.EqualFold(strings.TrimSpace(r.Header.Get("Save-Data")), "on")
+}
+
+// applyClientHints scales the dimensions of a transformation by the DPR, capping them at the width of the image on the client,
+// and lowers the quality when the client asks to save data
+// A DPR in the URL takes precedence over the DPR hint
+func (s *server) applyClientHints(t *image.Transform, r *http.Request) {
+	if !s.ClientHints || t.Raw {
+		return
+	}
+
+	dpr := getDPR(r)
+
+	switch t.DPR {
+	case 0:
+		t.Width, t.Height = scale(t.Width, dpr), scale(t.Height, dpr)
+	default:
+		*t = t.ApplyDPR()
+	}
+
+	if maxWidth := getMaxWidth(r, dpr); maxWidth != 0 && t.Width > maxWidth {
+		t.Height = scale(t.Height, float64(maxWidth)/float64(t.Width))
+		t.Width = maxWidth
+	}
+
+	if isSaveData(r) && (t.Quality == 0 || t.Quality > SaveDataQuality) {
+		t.Quality = SaveDataQuality
+	}
+}
+
+// setVary tells caches which request headers the response depends on
+func (s *server) setVary(path string, w http.ResponseWriter) {
+	if _, output := image.GetFilePathParts(path[strings.LastIndex(path, "/")+1:]); output == "" {
+		w.Header().Add("Vary", "Accept")
+	}
+
+	if s.ClientHints {
+		w.Header().Set("Accept-CH", acceptClientHints)
+		w.Header().Add("Vary", strings.Join(clientHintsVary, ", "))
+	}
+}
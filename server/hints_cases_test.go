@@ -0,0 +1,25 @@
+package server
+
+var hintsVary = "Sec-CH-DPR, Sec-CH-Width, Sec-CH-Viewport-Width, DPR, Width, Viewport-Width, Save-Data"
+
+var ClientHintsCases = []ClientHintsProvider{
+	{false, "/foo_100x50.jpg", map[string]string{"Sec-CH-DPR": "2", "Save-Data": "on"}, 100, 50, 0, nil},
+	{false, "/foo_100x50", nil, 100, 50, 0, []string{"Accept"}},
+	{true, "/foo_100x50.jpg", nil, 100, 50, 0, []string{hintsVary}},
+	{true, "/foo_100x50", nil, 100, 50, 0, []string{"Accept", hintsVary}},
+	{true, "/foo_100x50.jpg", map[string]string{"Sec-CH-DPR": "2"}, 200, 100, 0, []string{hintsVary}},
+	{true, "/foo_100x.jpg", map[string]string{"DPR": "1.5"}, 150, 0, 0, []string{hintsVary}},
+	{true, "/foo_100x50.jpg", map[string]string{"Sec-CH-DPR": "10"}, 400, 200, 0, []string{hintsVary}},
+	{true, "/foo_100x50.jpg", map[string]string{"Sec-CH-DPR": "bad"}, 100, 50, 0, []string{hintsVary}},
+	{true, "/foo_100x50.jpg", map[string]string{"Sec-CH-DPR": "NaN"}, 100, 50, 0, []string{hintsVary}},
+	{true, "/foo_100x50.jpg", map[string]string{"DPR": "nan"}, 100, 50, 0, []string{hintsVary}},
+	{true, "/foo_100x50.jpg", map[string]string{"Sec-CH-DPR": "-Inf"}, 100, 50, 0, []string{hintsVary}},
+	{true, "/foo_100x50.jpg", map[string]string{"Sec-CH-DPR": "Inf"}, 100, 50, 0, []string{hintsVary}},
+	{true, "/foo_400x200.jpg", map[string]string{"Sec-CH-DPR": "2", "Sec-CH-Width": "300"}, 300, 150, 0, []string{hintsVary}},
+	{true, "/foo_400x200.jpg", map[string]string{"Sec-CH-DPR": "2", "Sec-CH-Viewport-Width": "300"}, 600, 300, 0, []string{hintsVary}},
+	{true, "/foo_100x50.jpg", map[string]string{"Sec-CH-Width": "300"}, 100, 50, 0, []string{hintsVary}},
+	{true, "/foo_100x50.jpg", map[string]string{"Save-Data": "on"}, 100, 50, SaveDataQuality, []string{hintsVary}},
+	{true, "/foo_100x50_@3x.jpg", map[string]string{"Sec-CH-DPR": "2"}, 300, 150, 0, []string{hintsVary}},
+	{true, "/foo_400x200_@2x.jpg", map[string]string{"Sec-CH-Width": "600"}, 600, 300, 0, []string{hintsVary}},
+	{true, "/foo_raw.jpg", map[string]string{"Sec-CH-DPR": "2", "Save-Data": "on"}, 0, 0, 0, []string{hintsVary}},
+}
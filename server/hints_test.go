@@ -0,0 +1,59 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+type ClientHintsProvider struct {
+	clientHints bool
+	url         string
+	header      map[string]string
+	width       int
+	height      int
+	quality     int
+	vary        []string
+}
+
+func TestClientHints(t *testing.T) {
+	t.Parallel()
+	for _, c := range ClientHintsCases {
+		s := New(Options{
+			Backend:     "example.net",
+			ClientHints: c.clientHints,
+		})
+
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", c.url+"?explain", nil)
+
+		for name, value := range c.header {
+			req.Header.Set(name, value)
+		}
+
+		s.ServeHTTP(w, req)
+
+		var e Explain
+
+		if err := json.Unmarshal(w.Body.Bytes(), &e); err != nil {
+			t.Errorf("Explain for %v is not valid JSON: %v", c.url, err)
+		}
+
+		tr := e.Transform
+
+		if tr.Width != c.width || tr.Height != c.height || tr.Quality != c.quality {
+			t.Errorf("Transform for %v with %v is %dx%d with quality %d, want %dx%d with quality %d",
+				c.url, c.header, tr.Width, tr.Height, tr.Quality, c.width, c.height, c.quality)
+		}
+
+		if vary := w.Header()["Vary"]; !reflect.DeepEqual(vary, c.vary) {
+			t.Errorf("Vary for %v is %v, want %v", c.url, vary, c.vary)
+		}
+
+		if acceptCH := w.Header().Get("Accept-CH"); (acceptCH != "") != c.clientHints {
+			t.Errorf("Accept-CH for %v is %q, client hints enabled: %v", c.url, acceptCH, c.clientHints)
+		}
+	}
+}
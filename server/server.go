@@ -4,18 +4,19 @@ Package server provides server encoding, decoding and request handler for picel.
 package server
 
 import (
+	"bytes"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
-	"io/ioutil"
+	"log"
 	"net/http"
-	"os"
 	"strings"
 	"time"
 
 	"github.com/henvic/picel/client"
 	"github.com/henvic/picel/image"
+	"github.com/henvic/picel/logger"
 )
 
 const (
@@ -27,6 +28,9 @@ const (
 
 	// FlagHTTPSSchema is a short flag for the HTTPS schema
 	FlagHTTPSSchema = "s:"
+
+	// DefaultMaxDownloadSize is the default maximum size of an image downloaded from the backend, as the source is kept in memory
+	DefaultMaxDownloadSize = 64 << 20
 )
 
 var (
@@ -38,14 +42,156 @@ var (
 
 	// DownloadTimeout is the timeout for the download of a image from the backend
 	DownloadTimeout time.Duration
+
+	// Signer for the backend requests (i.e., S3 credentials)
+	Signer client.Signer
+
+	// Fetcher for loading the images (HTTP(S) backend is used if nil)
+	Fetcher client.Fetcher
+
+	// Retry policy for downloading images from the backend
+	Retry client.Retry
+
+	// Circuits are the circuit breakers for the backends
+	Circuits *client.Circuits
+
+	// Mirrors maps a backend to the ordered list of backends to try when it fails
+	Mirrors map[string][]string
+
+	// HedgeAfter is the latency after which a request to the next mirror is hedged (0 disables it)
+	HedgeAfter time.Duration
+
+	// ForwardHeaders is the list of request headers forwarded to the backend
+	// They are only sent to the single backend and the backends with mirrors, never to the hosts of the open mode
+	ForwardHeaders []string
+
+	// BackendHeaders maps a backend to the static headers sent to it (i.e., Authorization)
+	BackendHeaders map[string]http.Header
+
+	// MaxDownloadSize is the maximum size of an image downloaded from the backend (0 means unlimited)
+	MaxDownloadSize int64 = DefaultMaxDownloadSize
+
+	// ContentTypeCheck is the mode for validating the backend Content-Type against image.ValidInputMimeTypes
+	ContentTypeCheck = client.ContentTypeLenient
 )
 
+// Options of a picel server
+// The package variables hold the options used by Handler
+type Options struct {
+	Backend          string
+	Verbose          bool
+	DownloadTimeout  time.Duration
+	Signer           client.Signer
+	Fetcher          client.Fetcher
+	Retry            client.Retry
+	Circuits         *client.Circuits
+	Mirrors          map[string][]string
+	HedgeAfter       time.Duration
+	ForwardHeaders   []string
+	BackendHeaders   map[string]http.Header
+	MaxDownloadSize  int64
+	ContentTypeCheck string
+
+	// ClientHints enables scaling the images by the DPR, Width and Save-Data client hints
+	ClientHints bool
+
+	// Uploads enables processing images sent on POST and PUT requests, limited to MaxUploadSize bytes (0 means unlimited)
+	Uploads       bool
+	MaxUploadSize int64
+
+	// Cache is the Cache-Control policy of the image responses
+	Cache CachePolicy
+
+	// Processor is the image processing engine registry (a processor with the default engines is used if nil)
+	Processor *image.Processor
+
+	// Stdout and Stderr are the loggers (logger.Stdout and logger.Stderr are used if nil)
+	Stdout *log.Logger
+	Stderr *log.Logger
+}
+
+type server struct {
+	Options
+}
+
+// New server for the image frontend
+func New(o Options) http.Handler {
+	return newServer(o)
+}
+
+func newServer(o Options) *server {
+	if o.ContentTypeCheck == "" {
+		o.ContentTypeCheck = client.ContentTypeLenient
+	}
+
+	if o.Processor == nil {
+		o.Processor = &image.Processor{
+			Verbose: o.Verbose,
+			Stdout:  o.Stdout,
+			Stderr:  o.Stderr,
+		}
+	}
+
+	if forwardsCredentials(o.ForwardHeaders) {
+		o.Cache.private = true
+	}
+
+	return &server{o}
+}
+
+// options returns the options set on the package variables
+func options() Options {
+	return Options{
+		Backend:          Backend,
+		Verbose:          Verbose,
+		DownloadTimeout:  DownloadTimeout,
+		Signer:           Signer,
+		Fetcher:          Fetcher,
+		Retry:            Retry,
+		Circuits:         Circuits,
+		Mirrors:          Mirrors,
+		HedgeAfter:       HedgeAfter,
+		ForwardHeaders:   ForwardHeaders,
+		BackendHeaders:   BackendHeaders,
+		MaxDownloadSize:  MaxDownloadSize,
+		ContentTypeCheck: ContentTypeCheck,
+		Processor: &image.Processor{
+			Verbose: image.Verbose,
+		},
+	}
+}
+
+func (s *server) stdout() *log.Logger {
+	if s.Stdout == nil {
+		return logger.Stdout
+	}
+
+	return s.Stdout
+}
+
+func (s *server) stderr() *log.Logger {
+	if s.Stderr == nil {
+		return logger.Stderr
+	}
+
+	return s.Stderr
+}
+
 // Explain returns a structure telling how a given request was interpreted
 type Explain struct {
-	Message    string          `json:"message"`
-	Path       string          `json:"path"`
-	Transform  image.Transform `json:"transform"`
-	ErrorStack []string        `json:"errors"`
+	Message        string          `json:"message"`
+	Path           string          `json:"path"`
+	Transform      image.Transform `json:"transform"`
+	Backends       []string        `json:"backends,omitempty"`
+	BackendHeaders []string        `json:"backendHeaders,omitempty"`
+	Source         *SourceExplain  `json:"source,omitempty"`
+	ErrorStack     []string        `json:"errors"`
+}
+
+// SourceExplain tells how the source image was loaded (for ?explain=fetch)
+type SourceExplain struct {
+	client.Metadata
+	Error string `json:"error,omitempty"`
 }
 
 type crop struct {
@@ -62,6 +208,7 @@ type publicImage struct {
 	Crop    crop        `json:"crop"`
 	Width   json.Number `json:"width"`
 	Height  json.Number `json:"height"`
+	DPR     json.Number `json:"dpr"`
 	Output  string      `json:"output"`
 }
 
@@ -116,10 +263,14 @@ func Decode(rawurl string, defaultOutputFormat string) (transform image.Transfor
 
 // Encode a given image as a URL
 func Encode(transform image.Transform) (url string) {
+	return newServer(options()).encode(transform)
+}
+
+func (s *server) encode(transform image.Transform) (url string) {
 	url = image.Encode(transform)
 
-	if Backend != "" {
-		return compressHost(Backend) + "/" + url
+	if s.Backend != "" {
+		return compressHost(s.Backend) + "/" + url
 	}
 
 	source := transform.Image.Source
@@ -128,6 +279,17 @@ func Encode(transform image.Transform) (url string) {
 	return compressHost(source[0:len(source)-len(fullname)]) + url
 }
 
+// publicPath of an image on picel, without the backend in single backend mode
+func (s *server) publicPath(transform image.Transform) string {
+	url := s.encode(transform)
+
+	if s.Backend != "" {
+		url = strings.TrimPrefix(url, compressHost(s.Backend)+"/")
+	}
+
+	return url
+}
+
 func buildExplain(path string, transform image.Transform, err error, errs []error) Explain {
 	var errorsMessages []string
 	var message string
@@ -152,12 +314,37 @@ func buildExplain(path string, transform image.Transform, err error, errs []erro
 	}
 }
 
-func jsonEncodeTransformation(path string, t image.Transform, errs []error, err error) string {
-	res, _ := json.MarshalIndent(buildExplain(path, t, err, errs), "", "    ")
+// ExplainPath tells how a request path is interpreted by a server with the given options, like ?explain
+// The image is not loaded
+func ExplainPath(o Options, path string, defaultOutputFormat string) (Explain, error) {
+	s := newServer(o)
+	path = strings.TrimPrefix(path, "/")
+	source := path
+
+	if s.Backend != "" {
+		source = compressHost(s.Backend) + "/" + path
+	}
+
+	t, errs, err := Decode(source, defaultOutputFormat)
+	e := buildExplain("/"+path, t, err, errs)
+
+	if sources := s.getSources(t.Image.Source); len(sources) > 1 {
+		e.Backends = sources
+	}
+
+	return e, err
+}
+
+func jsonEncodeExplain(e Explain) string {
+	res, _ := json.MarshalIndent(e, "", "    ")
 
 	return string(res)
 }
 
+func jsonEncodeTransformation(path string, t image.Transform, errs []error, err error) string {
+	return jsonEncodeExplain(buildExplain(path, t, err, errs))
+}
+
 func isWebpCompatible(r *http.Request) bool {
 	accept := r.Header["Accept"]
 	return len(accept) != 0 && strings.Index(accept[0], "image/webp") != -1
@@ -171,48 +358,123 @@ func getDefaultRequestOutputFormat(r *http.Request) string {
 	return "jpg"
 }
 
-func processingHandler(filename string, t image.Transform, w http.ResponseWriter, r *http.Request) {
+// streamWriter tracks if the processed image started being written to the response
+type streamWriter struct {
+	http.ResponseWriter
+	wrote bool
+}
+
+func (sw *streamWriter) Write(p []byte) (int, error) {
+	sw.wrote = true
+	return sw.ResponseWriter.Write(p)
+}
+
+func (s *server) processingHandler(source *bytes.Buffer, t image.Transform, w http.ResponseWriter, r *http.Request) {
 	if t.Raw {
-		http.ServeFile(w, r, filename)
+		_, name := t.Image.Name()
+		http.ServeContent(w, r, name, time.Time{}, bytes.NewReader(source.Bytes()))
 		return
 	}
 
-	output, _ := ioutil.TempFile(os.TempDir(), "picel")
-	outputFilename := output.Name()
-	defer os.Remove(outputFilename)
+	w.Header().Set("Content-Type", image.OutputContentTypes[strings.ToLower(t.Output)])
+	sw := &streamWriter{ResponseWriter: w}
 
-	err := image.Process(t, filename, outputFilename)
+	err := s.Processor.ProcessStream(r.Context(), t, source, sw)
 
-	if err != nil {
+	switch {
+	case err == nil:
+	case !sw.wrote:
 		http.Error(w, "Processing error.", http.StatusInternalServerError)
+	default:
+		// abort the response so the client doesn't take a truncated image as complete
+		s.stderr().Println(fmt.Sprintf("Processing error for %v: %v", t.Image.Source, err))
+		panic(http.ErrAbortHandler)
+	}
+}
+
+func downloadErrorHandler(err error, w http.ResponseWriter, r *http.Request) {
+	switch e := err.(type) {
+	case *client.SizeError:
+		http.Error(w, "Source image too large.", http.StatusBadGateway)
+		return
+	case *client.ContentTypeError:
+		http.Error(w, e.Error()+".", http.StatusBadGateway)
 		return
 	}
 
-	http.ServeFile(w, r, outputFilename)
+	switch err {
+	case client.ErrCircuitOpen:
+		http.Error(w, "Backend unavailable.", http.StatusServiceUnavailable)
+	case client.ErrBackendUnavailable:
+		http.Error(w, "Backend failure.", http.StatusBadGateway)
+	default:
+		http.NotFound(w, r)
+	}
 }
 
-func loadingHandler(t image.Transform, w http.ResponseWriter, r *http.Request) {
-	file, _ := ioutil.TempFile(os.TempDir(), "picel")
-	defer os.Remove(file.Name())
-	filename := file.Name()
+func (s *server) newDownload(t image.Transform, buffer *bytes.Buffer, r *http.Request) *client.Download {
+	sources := s.getSources(t.Image.Source)
 
 	download := &client.Download{
-		URL:      t.Image.Source,
-		Filename: file.Name(),
+		URL:              sources[0],
+		Buffer:           buffer,
+		Signer:           s.Signer,
+		BackendHeaders:   s.getBackendHeaders(r),
+		Fetcher:          s.Fetcher,
+		Retry:            s.Retry,
+		Circuits:         s.Circuits,
+		Mirrors:          sources[1:],
+		HedgeAfter:       s.HedgeAfter,
+		MaxSize:          s.MaxDownloadSize,
+		ContentTypes:     s.inputMimeTypes(),
+		ContentTypeCheck: s.ContentTypeCheck,
+		Context:          r.Context(),
 	}
 
-	if DownloadTimeout > 0*time.Second {
-		download.Timeout(DownloadTimeout)
+	if s.DownloadTimeout > 0*time.Second {
+		download.Timeout(s.DownloadTimeout)
 	}
 
+	return download
+}
+
+func (s *server) inputMimeTypes() map[string]bool {
+	if s.Processor.InputMimeTypes == nil {
+		return image.ValidInputMimeTypes
+	}
+
+	return s.Processor.InputMimeTypes
+}
+
+func (s *server) load(t image.Transform, buffer *bytes.Buffer, r *http.Request) (*client.Download, error) {
+	download := s.newDownload(t, buffer, r)
 	err := download.Load()
 
+	s.logSource(t, download, err)
+	return download, err
+}
+
+func (s *server) loadingHandler(t image.Transform, w http.ResponseWriter, r *http.Request) {
+	var source bytes.Buffer
+	download, err := s.load(t, &source, r)
+
 	if err != nil {
-		http.NotFound(w, r)
+		downloadErrorHandler(err, w, r)
+		return
+	}
+
+	etag := renditionETag(download.Metadata.ETag, source.Bytes(), t)
+	w.Header().Set("ETag", etag)
+
+	s.Cache.setCacheHeaders(w.Header(), download.Metadata, time.Now())
+
+	// skip processing when the client already has the rendition
+	if matchETag(r.Header.Get("If-None-Match"), etag) {
+		w.WriteHeader(http.StatusNotModified)
 		return
 	}
 
-	processingHandler(filename, t, w, r)
+	s.processingHandler(&source, t, w, r)
 }
 
 func encodeCrop(c crop) (param string) {
@@ -245,9 +507,36 @@ func createRequestPath(body io.Reader) (path string, err error) {
 	decoder := json.NewDecoder(body)
 
 	var pi publicImage
-	var params []string
 
 	err = decoder.Decode(&pi)
+	path, pathErr := encodePublicImage(pi)
+
+	if err == nil {
+		err = pathErr
+	}
+
+	return path, err
+}
+
+// EncodeRequest returns the path of an image given with the request body format (JSON)
+func EncodeRequest(body io.Reader) (path string, err error) {
+	return createRequestPath(body)
+}
+
+func encodeDPR(dpr json.Number) string {
+	if f, err := dpr.Float64(); err == nil {
+		return image.EncodeDPR(f)
+	}
+
+	if dpr == "" {
+		return ""
+	}
+
+	return "@" + string(dpr) + "x"
+}
+
+func encodePublicImage(pi publicImage) (path string, err error) {
+	var params []string
 
 	if len(pi.Backend) != 0 {
 		path = "/" + strings.TrimSuffix(compressHost(pi.Backend), "/")
@@ -263,13 +552,22 @@ func createRequestPath(body io.Reader) (path string, err error) {
 
 	if pi.Raw {
 		path += "_" + image.Raw + "." + extension
-		return path, err
+		return path, nil
 	}
 
 	params = append(params, encodeCrop(pi.Crop))
 	params = append(params, encodeDimension(string(pi.Width), string(pi.Height)))
+	dpr := encodeDPR(pi.DPR)
+	params = append(params, dpr)
+	inputExtension := extension
+
+	if inputExtension == "" {
+		inputExtension = image.DefaultInputExtension
+	}
 
-	if pi.Output != extension && (extension != image.DefaultInputExtension || len(pi.Output) != 0) {
+	output := image.GetEncodingOutput(pi.Output, dpr, inputExtension)
+
+	if output != extension && (extension != image.DefaultInputExtension || len(output) != 0) {
 		params = append(params, image.EscapePath(extension))
 	}
 
@@ -277,8 +575,8 @@ func createRequestPath(body io.Reader) (path string, err error) {
 		path += image.EncodeParam(param)
 	}
 
-	if len(pi.Output) != 0 {
-		path += "." + image.EscapePath(pi.Output)
+	if len(output) != 0 {
+		path += "." + image.EscapePath(output)
 	}
 
 	if pi.Path == "" {
@@ -288,7 +586,33 @@ func createRequestPath(body io.Reader) (path string, err error) {
 	return path, err
 }
 
-func prepare(r *http.Request) (transform image.Transform, reqPath string, errs []error, err error) {
+// decodePublicImage decodes the transformation of an image given with the request body format
+func (s *server) decodePublicImage(pi publicImage, r *http.Request) (image.Transform, error) {
+	if s.Backend != "" {
+		pi.Backend = ""
+	}
+
+	if pi.Output == "" {
+		pi.Output = getDefaultRequestOutputFormat(r)
+	}
+
+	path, err := encodePublicImage(pi)
+
+	if err != nil {
+		return image.Transform{}, err
+	}
+
+	path = path[1:]
+
+	if s.Backend != "" {
+		path = compressHost(s.Backend) + "/" + path
+	}
+
+	t, _, err := Decode(path, pi.Output)
+	return t, err
+}
+
+func (s *server) prepare(r *http.Request) (transform image.Transform, reqPath string, errs []error, err error) {
 	path := r.URL.Path[1:]
 	reqPath = path
 	var errRequestPath error
@@ -303,8 +627,8 @@ func prepare(r *http.Request) (transform image.Transform, reqPath string, errs [
 		}
 	}
 
-	if Backend != "" {
-		path = compressHost(Backend) + "/" + path
+	if s.Backend != "" {
+		path = compressHost(s.Backend) + "/" + path
 	}
 
 	transform, errsDecode, err := Decode(path, getDefaultRequestOutputFormat(r))
@@ -319,16 +643,44 @@ func prepare(r *http.Request) (transform image.Transform, reqPath string, errs [
 	return transform, reqPath, errs, err
 }
 
-// Handler for the image frontend
+// Handler for the image frontend, configured by the package variables
 func Handler(w http.ResponseWriter, r *http.Request) {
-	// fmt.Println(r.URL.Path)
-	// os.Exit(34)
+	newServer(options()).ServeHTTP(w, r)
+}
+
+// ServeHTTP handles the requests for the image frontend
+func (s *server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w = &cacheWriter{
+		ResponseWriter: w,
+		policy:         s.Cache,
+	}
+
+	if r.URL.Query()["srcset"] != nil {
+		s.srcsetHandler(w, r)
+		return
+	}
+
+	if r.URL.Query()["batch"] != nil {
+		s.batchHandler(w, r)
+		return
+	}
+
+	if s.Uploads && isUpload(r) {
+		s.uploadHandler(w, r)
+		return
+	}
+
 	// requests to / with no body should fail with more information
-	transform, path, errs, err := prepare(r)
+	transform, path, errs, err := s.prepare(r)
+
+	if err == nil {
+		s.applyClientHints(&transform, r)
+	}
+
+	s.setVary(path, w)
 
 	if r.URL.Query()["explain"] != nil {
-		w.Header().Set("Content-Type", "application/json")
-		fmt.Fprint(w, jsonEncodeTransformation("/"+path, transform, errs, err))
+		s.explainHandler("/"+path, transform, errs, err, w, r)
 		return
 	}
 
@@ -337,5 +689,5 @@ func Handler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	loadingHandler(transform, w, r)
+	s.loadingHandler(transform, w, r)
 }
@@ -2,7 +2,9 @@ package server
 
 import (
 	"errors"
+	"strings"
 
+	"github.com/henvic/picel/client"
 	"github.com/henvic/picel/image"
 )
 
@@ -605,6 +607,12 @@ var BadRequestsURLCases = []BadRequestProvider{
 	{
 		"/_",
 	},
+	{
+		"/example.net/foo_@NaNx.png",
+	},
+	{
+		"/example.net/foo_100x_@Infx.png",
+	},
 }
 
 var BadRequestsJSONCases = []BadRequestProvider{
@@ -636,6 +644,48 @@ var BuildExplainCases = []BuildExplainProvider{
 		}},
 }
 
+var ExplainPathCases = []ExplainPathProvider{
+	{Options{}, "/example.net/foo_800x.webp", "", image.Transform{
+		Image: image.Image{
+			ID:        "foo",
+			Extension: "webp",
+			Source:    "http://example.net/foo.webp",
+		},
+		Path:   "foo_800x.webp",
+		Width:  800,
+		Output: "webp",
+	}, ""},
+	{Options{Backend: "https://example.net"}, "foo_0x0:100x100_png", "jpg", image.Transform{
+		Image: image.Image{
+			ID:        "foo",
+			Extension: "png",
+			Source:    "https://example.net/foo.png",
+		},
+		Path:   "foo_0x0:100x100_png",
+		Crop:   image.Crop{Width: 100, Height: 100},
+		Output: "jpg",
+	}, ""},
+	{Options{Backend: "example.net"}, "/bah_40x_@1.5x.png", "jpg", image.Transform{
+		Image: image.Image{
+			ID:        "bah",
+			Extension: "png",
+			Source:    "http://example.net/bah.png",
+		},
+		Path:   "bah_40x_@1.5x.png",
+		Width:  40,
+		DPR:    1.5,
+		Output: "png",
+	}, ""},
+	{Options{Backend: "example.net"}, "/foo_@9x.png", "jpg", image.Transform{
+		Image: image.Image{
+			ID:     "foo",
+			Source: "http://example.net/foo",
+		},
+		Path:   "foo_@9x.png",
+		Output: "png",
+	}, image.ErrInvalidDPR.Error()},
+}
+
 var ServerProcessingFailureCases = []ServerProcessingFailureProvider{
 	{"/empty__file.jpg"},
 	{"/insects_jpg.xoo"},
@@ -711,5 +761,116 @@ var CreateRequestPathCases = []CreateRequestPathProvider{
 	}, {
 		doc:  `{"path": "foo_bah.jpg", "width": "40", "output": "jpg"}`,
 		path: "/foo__bah_40x.jpg",
+	}, {
+		doc:  `{"path": "bah.jpg", "width": 40, "dpr": 2, "output": "jpg"}`,
+		path: "/bah_40x_@2x.jpg",
+	}, {
+		doc:  `{"path": "bah.jpg", "width": 40, "dpr": "1.5", "output": "webp"}`,
+		path: "/bah_40x_@1.5x_jpg.webp",
+	}, {
+		doc:  `{"path": "bah.jpg", "width": 40, "dpr": 1, "output": "jpg"}`,
+		path: "/bah_40x.jpg",
+	}, {
+		doc:  `{"path": "bah.jpg", "width": 40, "dpr": 1.5}`,
+		path: "/bah_40x_@1.5x.jpg",
+	}, {
+		doc:  `{"path": "bah.png", "width": 40, "dpr": "1.5"}`,
+		path: "/bah_40x_@1.5x.png",
+	}, {
+		doc:  `{"path": "bah", "width": 40, "dpr": 2.5}`,
+		path: "/bah_40x_@2.5x.jpg",
 	},
 }
+
+var GetSourcesCases = []GetSourcesProvider{
+	{nil, "http://example.net/foo.jpg", []string{"http://example.net/foo.jpg"}},
+	{
+		map[string][]string{"example.net": {"s:mirror1.example.net", "http://mirror2.example.net/"}},
+		"http://example.net/foo/bar.jpg",
+		[]string{"http://example.net/foo/bar.jpg", "https://mirror1.example.net/foo/bar.jpg", "http://mirror2.example.net/foo/bar.jpg"},
+	},
+	{
+		map[string][]string{"https://example.net": {"mirror.example.net"}},
+		"http://example.net/foo.jpg",
+		[]string{"http://example.net/foo.jpg"},
+	},
+	{
+		map[string][]string{"s:example.net": {"mirror.example.net"}},
+		"https://example.net/foo.jpg",
+		[]string{"https://example.net/foo.jpg", "http://mirror.example.net/foo.jpg"},
+	},
+	{
+		map[string][]string{"example.net": {"mirror.example.net"}},
+		"http://example.network/foo.jpg",
+		[]string{"http://example.network/foo.jpg"},
+	},
+	{
+		map[string][]string{"example.net": {"mirror.example.net"}, "example.net/private": {"private.example.net"}},
+		"http://example.net/private/foo.jpg",
+		[]string{"http://example.net/private/foo.jpg", "http://private.example.net/foo.jpg"},
+	},
+	{
+		map[string][]string{"example.net": {"mirror.example.net"}, "example.net/private": {"private.example.net"}},
+		"http://example.net/public/foo.jpg",
+		[]string{"http://example.net/public/foo.jpg", "http://mirror.example.net/public/foo.jpg"},
+	},
+}
+
+var ContentTypeCheckCases = []ContentTypeCheckProvider{
+	{client.ContentTypeLenient, "/memory/foo_raw.png", 502, "Backend returned unsupported content type text/html; charset=utf-8"},
+	{client.ContentTypeLenient, "/memory/bar_raw.png", 200, "bar"},
+	{client.ContentTypeStrict, "/memory/bar_raw.png", 502, "Backend returned unsupported content type application/octet-stream"},
+	{client.ContentTypeOff, "/memory/foo_raw.png", 200, "<html></html>"},
+	{client.ContentTypeStrict, "/memory/foo_raw.png?explain=fetch", 200, `"contentType": "text/html; charset=utf-8"`},
+	{client.ContentTypeStrict, "/memory/foo_raw.png?explain=fetch", 200, `"error": "Backend returned unsupported content type text/html; charset=utf-8"`},
+}
+
+var ServerStreamCases = []ServerStreamProvider{
+	{"/foo_gif.png", 200, "image/png", "GIF89a"},
+	{"/foo_raw.gif", 200, "image/gif", "GIF89a"},
+	{"/foo_gif.webp", 500, "text/plain; charset=utf-8", "Processing error.\n"},
+	{"/bar_gif.png", 500, "text/plain; charset=utf-8", "Processing error.\n"},
+}
+
+var uploadContentType, uploadMultipartBody = multipartUpload(`{"path": "foo.jpg", "width": 10, "output": "png"}`, "GIF89a")
+var uploadNoImageContentType, uploadNoImageBody = multipartUpload(`{"path": "foo.jpg", "output": "png"}`, "")
+var uploadBadContentType, uploadBadBody = multipartUpload(`{"path": "foo.jpg", "output": "png"}`, "not an image")
+
+var ServerUploadCases = []ServerUploadProvider{
+	{"POST", "/foo_10x20.png", "image/gif", "GIF89a", 200, "gif 10x20 GIF89a"},
+	{"PUT", "/foo_10x20.png", "", "GIF89a", 200, "gif 10x20 GIF89a"},
+	{"POST", "/foo_raw.gif", "image/gif", "GIF89a", 200, "GIF89a"},
+	{"POST", "/", uploadContentType, uploadMultipartBody, 200, "gif 10x0 GIF89a"},
+	{"POST", "/?explain", uploadContentType, uploadMultipartBody, 200, `"contentType": "image/gif"`},
+	{"POST", "/", uploadNoImageContentType, uploadNoImageBody, 400, "Bad request."},
+	{"POST", "/?explain", uploadNoImageContentType, uploadNoImageBody, 200, `"message": "Missing image"`},
+	{"POST", "/", uploadBadContentType, uploadBadBody, 415, "The loaded file mime type is not supported."},
+	{"POST", "/foo_10x20.png?explain", "", "not an image", 200, `"error": "The loaded file mime type is not supported"`},
+	{"POST", "/foo_10x20.png", "", strings.Repeat("GIF89a", 100), 413, "Upload too large."},
+	{"POST", "/foo_10x20.png?explain", "", strings.Repeat("GIF89a", 100), 200, `"message": "Upload exceeds the maximum upload size"`},
+	{"POST", "/foo_10x20_jpg.xoo", "", "GIF89a", 500, "Processing error."},
+}
+
+var batchItems = []BatchItem{
+	{"/example.net/foo_100x_gif.png", 200, "image/png", 12, []byte("100x0 GIF89a"), ""},
+	{"/example.net/foo_20x10_gif.jpg", 200, "image/jpeg", 12, []byte("20x10 GIF89a"), ""},
+	{"/example.net/foo_gif.webp", 500, "", 0, nil, "Processing error."},
+	{"/example.net/foo_raw.gif", 200, "image/gif", 6, []byte("GIF89a"), ""},
+}
+
+var batchBody = `{"backend": "example.net", "path": "foo.gif", "renditions": [
+	{"width": 100, "output": "png"},
+	{"width": 20, "height": 10},
+	{"output": "webp"},
+	{"raw": true}
+]}`
+
+var ServerBatchCases = []ServerBatchProvider{
+	{"/?batch", batchBody, 200, batchItems},
+	{"/?batch=json", batchBody, 200, batchItems},
+	{"/?batch", `{"backend": "example.net", "path": "bar.gif", "renditions": [{"width": 100}]}`, 404, nil},
+	{"/?batch", `{"backend": "example.net", "path": "foo.gif", "renditions": []}`, 400, nil},
+	{"/?batch", `{"backend": "example.net", "path": "foo.gif"`, 400, nil},
+	{"/?batch", `{"backend": "example.net", "renditions": [{"width": 100}]}`, 400, nil},
+	{"/?batch", `{"path": "foo.gif", "renditions": [` + strings.Repeat(`{"width": 100},`, MaxBatchRenditions) + `{}]}`, 400, nil},
+}
@@ -2,10 +2,14 @@ package server
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"io/ioutil"
+	"log"
+	"mime"
+	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
 	"os"
@@ -14,8 +18,11 @@ import (
 	"regexp"
 	"strconv"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/henvic/picel/client"
 	"github.com/henvic/picel/image"
 )
 
@@ -355,6 +362,85 @@ func TestServerNotFound(t *testing.T) {
 	}
 }
 
+func TestServerWithFetcher(t *testing.T) {
+	// don't run in parallel due to mocking Fetcher
+	fetcher := &client.Memory{}
+	fetcher.Put("http://memory/foo.png", []byte("foo"), "image/png")
+
+	defaultFetcher := Fetcher
+	Fetcher = fetcher
+
+	req, _ := http.NewRequest("GET", "/memory/foo_raw.png", nil)
+	w := httptest.NewRecorder()
+	http.HandlerFunc(Handler).ServeHTTP(w, req)
+
+	reqNotFound, _ := http.NewRequest("GET", "/memory/bar_raw.png", nil)
+	wNotFound := httptest.NewRecorder()
+	http.HandlerFunc(Handler).ServeHTTP(wNotFound, reqNotFound)
+
+	Fetcher = defaultFetcher
+
+	if w.Code != http.StatusOK || w.Body.String() != "foo" {
+		t.Errorf("Request status code response is %v (%v), want %v (%v)", w.Code, w.Body.String(), http.StatusOK, "foo")
+	}
+
+	if wNotFound.Code != http.StatusNotFound {
+		t.Errorf("Request status code response is %v, want %v", wNotFound.Code, http.StatusNotFound)
+	}
+}
+
+func TestServerBackendUnavailable(t *testing.T) {
+	// don't run in parallel due to mocking Circuits
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+
+	failing := httptest.NewServer(http.HandlerFunc(handler))
+	defer failing.Close()
+
+	defaultCircuits := Circuits
+	Circuits = &client.Circuits{
+		Threshold: 1,
+		Cooldown:  time.Minute,
+	}
+
+	url := "/" + compressHost(failing.URL) + "/foo_raw.jpg"
+
+	req, _ := http.NewRequest("GET", url, nil)
+	w := httptest.NewRecorder()
+	http.HandlerFunc(Handler).ServeHTTP(w, req)
+
+	reqOpen, _ := http.NewRequest("GET", url, nil)
+	wOpen := httptest.NewRecorder()
+	http.HandlerFunc(Handler).ServeHTTP(wOpen, reqOpen)
+
+	reqStatus, _ := http.NewRequest("GET", "/statusz", nil)
+	wStatus := httptest.NewRecorder()
+	http.HandlerFunc(StatusHandler).ServeHTTP(wStatus, reqStatus)
+
+	Circuits = defaultCircuits
+
+	if w.Code != http.StatusBadGateway {
+		t.Errorf("Request status code response is %v, want %v", w.Code, http.StatusBadGateway)
+	}
+
+	if wOpen.Code != http.StatusServiceUnavailable {
+		t.Errorf("Request status code response is %v, want %v", wOpen.Code, http.StatusServiceUnavailable)
+	}
+
+	var status Status
+
+	if err := json.Unmarshal(wStatus.Body.Bytes(), &status); err != nil {
+		t.Errorf("Status response is not valid JSON: %v", err)
+	}
+
+	host := strings.TrimPrefix(failing.URL, "http://")
+
+	if status.Circuits[host].State != client.CircuitOpen {
+		t.Errorf("Circuit for %v should be open, got %+v instead", host, status.Circuits)
+	}
+}
+
 func identifyImageDetails(filename string, meta []string, transform image.Transform, t *testing.T) {
 	// imagick doesn't support decoding some standards like .gif
 	if meta == nil {
@@ -539,6 +625,34 @@ func TestCreateRequestPath(t *testing.T) {
 	}
 }
 
+type ExplainPathProvider struct {
+	options   Options
+	path      string
+	output    string
+	transform image.Transform
+	message   string
+}
+
+func TestExplainPath(t *testing.T) {
+	t.Parallel()
+	for _, c := range ExplainPathCases {
+		e, err := ExplainPath(c.options, c.path, c.output)
+		message := c.message
+
+		if message == "" {
+			message = "Success. Image path parsed and decoded correctly"
+		}
+
+		if (err == nil) != (c.message == "") {
+			t.Errorf("ExplainPath(%v) returned error %v, want %v", c.path, err, c.message)
+		}
+
+		if !reflect.DeepEqual(e.Transform, c.transform) || e.Message != message || e.Path != "/"+strings.TrimPrefix(c.path, "/") {
+			t.Errorf("ExplainPath(%v) == %+v, want transform %+v with message %v", c.path, e, c.transform, message)
+		}
+	}
+}
+
 func benchmarkGoodRequest(compBackend string, c GoodRequestProvider, t *testing.B) {
 	url := "/" + compBackend + c.url
 
@@ -574,3 +688,492 @@ func BenchmarkServerGoodRequestsPerformance(t *testing.B) {
 
 	Backend = defaultBackend
 }
+
+type ContentTypeCheckProvider struct {
+	mode string
+	url  string
+	code int
+	body string
+}
+
+type GetSourcesProvider struct {
+	mirrors map[string][]string
+	source  string
+	want    []string
+}
+
+func TestGetSources(t *testing.T) {
+	t.Parallel()
+	for _, c := range GetSourcesCases {
+		s := newServer(Options{
+			Mirrors: c.mirrors,
+		})
+
+		got := s.getSources(c.source)
+
+		if !reflect.DeepEqual(got, c.want) {
+			t.Errorf("getSources(%v) with mirrors %v == %v, want %v", c.source, c.mirrors, got, c.want)
+		}
+	}
+}
+
+func TestServerExplainFetch(t *testing.T) {
+	// don't run in parallel due to mocking Backend, Fetcher and Mirrors
+	fetcher := &client.Memory{}
+	fetcher.Put("http://mirror/foo.png", []byte("foo"), "image/png")
+
+	defaultBackend := Backend
+	defaultFetcher := Fetcher
+	defaultMirrors := Mirrors
+	Backend = ""
+	Fetcher = fetcher
+	Mirrors = map[string][]string{
+		"memory": {"mirror"},
+	}
+
+	req, _ := http.NewRequest("GET", "/memory/foo_raw.png?explain=fetch", nil)
+	w := httptest.NewRecorder()
+	http.HandlerFunc(Handler).ServeHTTP(w, req)
+
+	reqNotFound, _ := http.NewRequest("GET", "/memory/bar_raw.png?explain=fetch", nil)
+	wNotFound := httptest.NewRecorder()
+	http.HandlerFunc(Handler).ServeHTTP(wNotFound, reqNotFound)
+
+	Backend = defaultBackend
+	Fetcher = defaultFetcher
+	Mirrors = defaultMirrors
+
+	var e Explain
+
+	if err := json.Unmarshal(w.Body.Bytes(), &e); err != nil {
+		t.Fatalf("Explain response is not valid JSON: %v", err)
+	}
+
+	wantBackends := []string{"http://memory/foo.png", "http://mirror/foo.png"}
+
+	if !reflect.DeepEqual(e.Backends, wantBackends) {
+		t.Errorf("Explain backends == %v, want %v", e.Backends, wantBackends)
+	}
+
+	if e.Source == nil || e.Source.Source != "http://mirror/foo.png" || e.Source.Size != 3 || e.Source.Error != "" {
+		t.Errorf("Explain source == %+v, want it to be served by %v", e.Source, "http://mirror/foo.png")
+	}
+
+	var eNotFound Explain
+
+	if err := json.Unmarshal(wNotFound.Body.Bytes(), &eNotFound); err != nil {
+		t.Fatalf("Explain response is not valid JSON: %v", err)
+	}
+
+	if eNotFound.Source == nil || eNotFound.Source.Error != http.ErrMissingFile.Error() {
+		t.Errorf("Explain source == %+v, want error %v", eNotFound.Source, http.ErrMissingFile)
+	}
+}
+
+func TestServerForwardHeaders(t *testing.T) {
+	// don't run in parallel due to mocking Backend, ForwardHeaders and BackendHeaders
+	var got http.Header
+
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header
+		w.Header().Set("Content-Type", "image/png")
+		w.Write([]byte("foo"))
+	}
+
+	backend := httptest.NewServer(http.HandlerFunc(handler))
+	defer backend.Close()
+
+	defaultBackend := Backend
+	defaultForwardHeaders := ForwardHeaders
+	defaultBackendHeaders := BackendHeaders
+	Backend = backend.URL
+	ForwardHeaders = []string{"cookie", "Connection"}
+	BackendHeaders = map[string]http.Header{
+		backend.URL: {
+			"Authorization": {client.BearerAuth("secret-token")},
+		},
+	}
+
+	url := "/foo_raw.png"
+
+	req, _ := http.NewRequest("GET", url, nil)
+	req.Header.Set("Cookie", "session=foo")
+	req.Header.Set("X-Other", "bar")
+	w := httptest.NewRecorder()
+	http.HandlerFunc(Handler).ServeHTTP(w, req)
+
+	reqExplain, _ := http.NewRequest("GET", url+"?explain", nil)
+	reqExplain.Header.Set("Cookie", "session=foo")
+	wExplain := httptest.NewRecorder()
+	http.HandlerFunc(Handler).ServeHTTP(wExplain, reqExplain)
+
+	Backend = defaultBackend
+	ForwardHeaders = defaultForwardHeaders
+	BackendHeaders = defaultBackendHeaders
+
+	if w.Code != http.StatusOK {
+		t.Errorf("Request status code response is %v, want %v", w.Code, http.StatusOK)
+	}
+
+	if got.Get("Cookie") != "session=foo" || got.Get("Authorization") != "Bearer secret-token" || got.Get("X-Other") != "" {
+		t.Errorf("Headers sent to the backend are not valid: %v", got)
+	}
+
+	if cc := w.Header().Get("Cache-Control"); cc != "private" {
+		t.Errorf("Cache-Control forwarding the cookies is %q, want %q", cc, "private")
+	}
+
+	if strings.Index(wExplain.Body.String(), "secret-token") != -1 || strings.Index(wExplain.Body.String(), "session=foo") != -1 {
+		t.Errorf("Explain should not expose header values: %v", wExplain.Body.String())
+	}
+
+	var e Explain
+
+	if err := json.Unmarshal(wExplain.Body.Bytes(), &e); err != nil {
+		t.Fatalf("Explain response is not valid JSON: %v", err)
+	}
+
+	if want := []string{"Authorization", "Cookie"}; !reflect.DeepEqual(e.BackendHeaders, want) {
+		t.Errorf("Explain backend headers == %v, want %v", e.BackendHeaders, want)
+	}
+}
+
+func TestDefaultMaxDownloadSize(t *testing.T) {
+	// don't run in parallel due to reading MaxDownloadSize
+	if size := options().MaxDownloadSize; size <= 0 || size != DefaultMaxDownloadSize {
+		t.Errorf("Default maximum download size is %v, want %v", size, DefaultMaxDownloadSize)
+	}
+}
+
+func TestServerForwardHeadersOpenMode(t *testing.T) {
+	t.Parallel()
+	var mutex sync.Mutex
+	got := map[string]string{}
+
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		got[r.Host] = r.Header.Get("Cookie")
+		mutex.Unlock()
+		w.Header().Set("Content-Type", "image/png")
+		w.Write([]byte("foo"))
+	}
+
+	listed := httptest.NewServer(http.HandlerFunc(handler))
+	defer listed.Close()
+
+	mirror := httptest.NewServer(http.HandlerFunc(handler))
+	defer mirror.Close()
+
+	unlisted := httptest.NewServer(http.HandlerFunc(handler))
+	defer unlisted.Close()
+
+	s := New(Options{
+		ForwardHeaders: []string{"Cookie"},
+		Mirrors: map[string][]string{
+			listed.URL: {mirror.URL},
+		},
+	})
+
+	for _, backend := range []string{listed.URL, unlisted.URL} {
+		req, _ := http.NewRequest("GET", "/"+compressHost(backend)+"/foo_raw.png", nil)
+		req.Header.Set("Cookie", "session=secret")
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, req)
+
+		if w.Code != http.StatusOK {
+			t.Errorf("Request to %v status code response is %v, want %v", backend, w.Code, http.StatusOK)
+		}
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	if cookie := got[listed.Listener.Addr().String()]; cookie != "session=secret" {
+		t.Errorf("Backend with mirrors should get the forwarded headers, got Cookie %q instead", cookie)
+	}
+
+	if cookie, ok := got[unlisted.Listener.Addr().String()]; !ok || cookie != "" {
+		t.Errorf("Host chosen by the request path should get no forwarded headers, got Cookie %q instead", cookie)
+	}
+}
+
+func TestServerMaxDownloadSize(t *testing.T) {
+	// don't run in parallel due to mocking Backend, Fetcher and MaxDownloadSize
+	fetcher := &client.Memory{}
+	fetcher.Put("http://memory/foo.png", []byte("0123456789"), "image/png")
+
+	defaultBackend := Backend
+	defaultFetcher := Fetcher
+	defaultMaxDownloadSize := MaxDownloadSize
+	Backend = ""
+	Fetcher = fetcher
+	MaxDownloadSize = 5
+
+	req, _ := http.NewRequest("GET", "/memory/foo_raw.png", nil)
+	w := httptest.NewRecorder()
+	http.HandlerFunc(Handler).ServeHTTP(w, req)
+
+	Backend = defaultBackend
+	Fetcher = defaultFetcher
+	MaxDownloadSize = defaultMaxDownloadSize
+
+	if w.Code != http.StatusBadGateway {
+		t.Errorf("Request status code response is %v, want %v", w.Code, http.StatusBadGateway)
+	}
+
+	if client.Metrics.Get("rejected_size") == nil {
+		t.Errorf("Rejected downloads should be counted on the metrics")
+	}
+}
+
+func TestServerContentTypeCheck(t *testing.T) {
+	// don't run in parallel due to mocking Backend, Fetcher and ContentTypeCheck
+	fetcher := &client.Memory{}
+	fetcher.Put("http://memory/foo.png", []byte("<html></html>"), "text/html; charset=utf-8")
+	fetcher.Put("http://memory/bar.png", []byte("bar"), "application/octet-stream")
+
+	defaultBackend := Backend
+	defaultFetcher := Fetcher
+	defaultContentTypeCheck := ContentTypeCheck
+	Backend = ""
+	Fetcher = fetcher
+
+	for _, c := range ContentTypeCheckCases {
+		ContentTypeCheck = c.mode
+
+		req, _ := http.NewRequest("GET", c.url, nil)
+		w := httptest.NewRecorder()
+		http.HandlerFunc(Handler).ServeHTTP(w, req)
+
+		if w.Code != c.code || strings.Index(w.Body.String(), c.body) == -1 {
+			t.Errorf("Request for %v in %v mode response is %v (%v), want %v (%v)",
+				c.url, c.mode, w.Code, w.Body.String(), c.code, c.body)
+		}
+	}
+
+	Backend = defaultBackend
+	Fetcher = defaultFetcher
+	ContentTypeCheck = defaultContentTypeCheck
+}
+
+func TestNew(t *testing.T) {
+	t.Parallel()
+	fetcher := &client.Memory{}
+	fetcher.Put("http://example.net/foo.jpg", []byte("example.net raw"), "image/jpeg")
+	fetcher.Put("https://example.com/foo.jpg", []byte("example.com raw"), "image/jpeg")
+
+	handlers := map[string]http.Handler{
+		"example.net raw": New(Options{
+			Backend: "http://example.net",
+			Fetcher: fetcher,
+		}),
+		"example.com raw": New(Options{
+			Backend: "https://example.com",
+			Fetcher: fetcher,
+		}),
+	}
+
+	for want, h := range handlers {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/foo_raw.jpg", nil)
+		h.ServeHTTP(w, req)
+
+		if w.Code != http.StatusOK || w.Body.String() != want {
+			t.Errorf("Expected raw request to return %v with status code %v, got %v with %v instead",
+				want, http.StatusOK, w.Body.String(), w.Code)
+		}
+	}
+}
+
+type ServerStreamProvider struct {
+	url         string
+	code        int
+	contentType string
+	body        string
+}
+
+func TestServerStream(t *testing.T) {
+	t.Parallel()
+	fetcher := &client.Memory{}
+	fetcher.Put("http://example.net/foo.gif", []byte("GIF89a"), "image/gif")
+	fetcher.Put("http://example.net/bar.gif", []byte("not a gif"), "image/gif")
+
+	s := New(Options{
+		Backend: "http://example.net",
+		Fetcher: fetcher,
+		Processor: &image.Processor{
+			Engines: map[string]image.Engine{
+				"Imagick": func(p *image.Processor, ctx context.Context, t image.Transform, input io.Reader, output io.Writer) error {
+					_, err := io.Copy(output, input)
+					return err
+				},
+				"Webp": func(p *image.Processor, ctx context.Context, t image.Transform, input io.Reader, output io.Writer) error {
+					return &image.ProgramError{Program: "cwebp"}
+				},
+			},
+		},
+	})
+
+	for _, c := range ServerStreamCases {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", c.url, nil)
+		s.ServeHTTP(w, req)
+
+		if w.Code != c.code || w.Header().Get("Content-Type") != c.contentType || w.Body.String() != c.body {
+			t.Errorf("Request to %v returned %v with %v and body %q, want %v with %v and body %q",
+				c.url, w.Code, w.Header().Get("Content-Type"), w.Body.String(), c.code, c.contentType, c.body)
+		}
+	}
+}
+
+type ServerUploadProvider struct {
+	method      string
+	url         string
+	contentType string
+	body        string
+	code        int
+	want        string
+}
+
+func multipartUpload(transform string, img string) (contentType string, body string) {
+	var b bytes.Buffer
+	mw := multipart.NewWriter(&b)
+
+	if transform != "" {
+		mw.WriteField("transform", transform)
+	}
+
+	if img != "" {
+		fw, _ := mw.CreateFormFile("image", "upload")
+		io.WriteString(fw, img)
+	}
+
+	mw.Close()
+	return mw.FormDataContentType(), b.String()
+}
+
+func TestServerUpload(t *testing.T) {
+	t.Parallel()
+	s := New(Options{
+		Uploads:       true,
+		MaxUploadSize: 512,
+		Processor: &image.Processor{
+			Engines: map[string]image.Engine{
+				"Imagick": func(p *image.Processor, ctx context.Context, t image.Transform, input io.Reader, output io.Writer) error {
+					fmt.Fprintf(output, "%v %dx%d ", t.Extension, t.Width, t.Height)
+					_, err := io.Copy(output, input)
+					return err
+				},
+			},
+		},
+	})
+
+	for _, c := range ServerUploadCases {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(c.method, c.url, strings.NewReader(c.body))
+		req.Header.Set("Content-Type", c.contentType)
+		s.ServeHTTP(w, req)
+
+		if w.Code != c.code || !strings.Contains(w.Body.String(), c.want) {
+			t.Errorf("%v request to %v returned %v with body %q, want %v with %q",
+				c.method, c.url, w.Code, w.Body.String(), c.code, c.want)
+		}
+	}
+}
+
+func TestServerUploadsDisabled(t *testing.T) {
+	t.Parallel()
+	s := New(Options{})
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/?explain", strings.NewReader(`{"path": "foo.jpg"}`))
+	s.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"path": "/foo"`) {
+		t.Errorf("POST should be handled as GET when uploads are disabled, got %v with %v", w.Code, w.Body.String())
+	}
+}
+
+type ServerBatchProvider struct {
+	url  string
+	body string
+	code int
+	want []BatchItem
+}
+
+func newBatchServer() http.Handler {
+	fetcher := &client.Memory{}
+	fetcher.Put("http://example.net/foo.gif", []byte("GIF89a"), "image/gif")
+
+	return New(Options{
+		Fetcher: fetcher,
+		Stderr:  log.New(ioutil.Discard, "", 0),
+		Processor: &image.Processor{
+			Engines: map[string]image.Engine{
+				"Imagick": func(p *image.Processor, ctx context.Context, t image.Transform, input io.Reader, output io.Writer) error {
+					fmt.Fprintf(output, "%dx%d ", t.Width, t.Height)
+					_, err := io.Copy(output, input)
+					return err
+				},
+				"Webp": func(p *image.Processor, ctx context.Context, t image.Transform, input io.Reader, output io.Writer) error {
+					return &image.ProgramError{Program: "gif2webp"}
+				},
+			},
+		},
+	})
+}
+
+func readBatchMultipart(w *httptest.ResponseRecorder) (items []BatchItem) {
+	_, params, _ := mime.ParseMediaType(w.Header().Get("Content-Type"))
+	mr := multipart.NewReader(w.Body, params["boundary"])
+
+	for {
+		part, err := mr.NextPart()
+
+		if err != nil {
+			return items
+		}
+
+		data, _ := ioutil.ReadAll(part)
+		status, _ := strconv.Atoi(part.Header.Get("X-Picel-Status"))
+		item := BatchItem{
+			Path:        part.Header.Get("Content-Location"),
+			Status:      status,
+			ContentType: part.Header.Get("Content-Type"),
+			Size:        len(data),
+			Data:        data,
+		}
+
+		if status != http.StatusOK {
+			item.ContentType, item.Size, item.Data, item.Error = "", 0, nil, strings.TrimSpace(string(data))
+		}
+
+		items = append(items, item)
+	}
+}
+
+func TestServerBatch(t *testing.T) {
+	t.Parallel()
+	s := newBatchServer()
+
+	for _, c := range ServerBatchCases {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", c.url, strings.NewReader(c.body))
+		s.ServeHTTP(w, req)
+
+		var items []BatchItem
+
+		switch {
+		case w.Code != http.StatusOK:
+		case strings.HasSuffix(c.url, "=json"):
+			var manifest BatchManifest
+			json.Unmarshal(w.Body.Bytes(), &manifest)
+			items = manifest.Items
+		default:
+			items = readBatchMultipart(w)
+		}
+
+		if w.Code != c.code || !reflect.DeepEqual(items, c.want) {
+			t.Errorf("Batch request %v to %v returned %v with %+v, want %v with %+v", c.body, c.url, w.Code, items, c.code, c.want)
+		}
+	}
+}
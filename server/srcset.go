@@ -0,0 +1,220 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/henvic/picel/image"
+)
+
+var (
+	// ErrSrcsetMissingCandidates is returned when neither widths nor DPRs are given
+	ErrSrcsetMissingCandidates = errors.New("Either widths or DPRs are required")
+
+	// ErrSrcsetBothCandidates is returned when both widths and DPRs are given
+	ErrSrcsetBothCandidates = errors.New("Widths and DPRs can't be used together")
+
+	// ErrSrcsetMissingFormats is returned when no output format is given
+	ErrSrcsetMissingFormats = errors.New("At least one format is required")
+
+	// ErrSrcsetMissingSize is returned when DPRs are given without the 1x width or height
+	ErrSrcsetMissingSize = errors.New("DPRs require the 1x width or height")
+
+	// ErrSrcsetInvalidCandidate is returned when a width or DPR is not positive or a DPR is greater than image.MaxDPR
+	ErrSrcsetInvalidCandidate = errors.New("Widths and DPRs must be greater than zero, and DPRs up to 4")
+)
+
+// SrcsetOptions describes the candidates of a responsive image
+// Transform has the source and crop, and the 1x width and height when DPRs are used (the URLs keep them, with the @<dpr>x parameter)
+// For widths, the height is scaled proportionally when both the width and height of the transform are set
+type SrcsetOptions struct {
+	Transform image.Transform
+	Widths    []int
+	DPRs      []float64
+	Formats   []string
+	Sizes     string
+
+	// Base is prepended to the encoded URLs (default: /)
+	Base string
+}
+
+// PictureSource is a <source> of a <picture> element
+type PictureSource struct {
+	Type   string `json:"type"`
+	Srcset string `json:"srcset"`
+	Sizes  string `json:"sizes,omitempty"`
+}
+
+// PictureImage is the fallback <img> of a <picture> element
+type PictureImage struct {
+	Src    string `json:"src"`
+	Srcset string `json:"srcset"`
+	Sizes  string `json:"sizes,omitempty"`
+}
+
+// Picture describes a <picture> element, with a source for each format but the last (used for the fallback image)
+type Picture struct {
+	Sources []PictureSource   `json:"sources"`
+	Image   PictureImage      `json:"img"`
+	Srcset  map[string]string `json:"srcset"`
+}
+
+// srcsetRequest is the request body for ?srcset
+type srcsetRequest struct {
+	publicImage
+	Widths  []int     `json:"widths"`
+	DPRs    []float64 `json:"dprs"`
+	Formats []string  `json:"formats"`
+	Sizes   string    `json:"sizes"`
+	Base    string    `json:"base"`
+}
+
+// NewPicture builds the srcset strings and the <picture> description of a responsive image
+// Every URL is built with Encode (without the backend in single backend mode)
+func NewPicture(o SrcsetOptions) (Picture, error) {
+	return buildPicture(o, newServer(options()).publicPath)
+}
+
+func validateSrcset(o SrcsetOptions) error {
+	switch {
+	case len(o.Widths) == 0 && len(o.DPRs) == 0:
+		return ErrSrcsetMissingCandidates
+	case len(o.Widths) != 0 && len(o.DPRs) != 0:
+		return ErrSrcsetBothCandidates
+	case len(o.Formats) == 0:
+		return ErrSrcsetMissingFormats
+	case len(o.DPRs) != 0 && o.Transform.Width == 0 && o.Transform.Height == 0:
+		return ErrSrcsetMissingSize
+	}
+
+	for _, format := range o.Formats {
+		if _, ok := image.OutputFormats[format]; !ok {
+			return image.ErrOutputFormatNotSupported
+		}
+	}
+
+	for _, w := range o.Widths {
+		if w <= 0 {
+			return ErrSrcsetInvalidCandidate
+		}
+	}
+
+	for _, dpr := range o.DPRs {
+		if !image.ValidDPR(dpr) {
+			return ErrSrcsetInvalidCandidate
+		}
+	}
+
+	return nil
+}
+
+func scale(size int, factor float64) int {
+	return int(math.Floor(float64(size)*factor + 0.5))
+}
+
+// srcset builds the srcset string of a format
+func srcset(o SrcsetOptions, format string, encode func(image.Transform) string) (set string, src string) {
+	var candidates []string
+
+	t := o.Transform
+	t.Raw = false
+	t.Output = format
+
+	for _, w := range o.Widths {
+		// the w descriptor is the width of the image, so the DPR of the transform doesn't apply
+		c := t
+		c.Width = w
+		c.DPR = 0
+
+		if t.Width != 0 && t.Height != 0 {
+			c.Height = scale(t.Height, float64(w)/float64(t.Width))
+		}
+
+		candidates = append(candidates, fmt.Sprintf("%s%s %dw", o.Base, encode(c), w))
+	}
+
+	for _, dpr := range o.DPRs {
+		c := t
+		c.DPR = dpr
+		candidates = append(candidates, fmt.Sprintf("%s%s %sx", o.Base, encode(c), strconv.FormatFloat(dpr, 'f', -1, 64)))
+	}
+
+	return strings.Join(candidates, ", "), strings.SplitN(candidates[0], " ", 2)[0]
+}
+
+func buildPicture(o SrcsetOptions, encode func(image.Transform) string) (p Picture, err error) {
+	if err = validateSrcset(o); err != nil {
+		return p, err
+	}
+
+	if o.Base == "" {
+		o.Base = "/"
+	}
+
+	p.Srcset = map[string]string{}
+	p.Sources = []PictureSource{}
+
+	for i, format := range o.Formats {
+		set, src := srcset(o, format, encode)
+		p.Srcset[format] = set
+
+		if i != len(o.Formats)-1 {
+			p.Sources = append(p.Sources, PictureSource{
+				Type:   image.OutputContentTypes[strings.ToLower(format)],
+				Srcset: set,
+				Sizes:  o.Sizes,
+			})
+
+			continue
+		}
+
+		p.Image = PictureImage{
+			Src:    src,
+			Srcset: set,
+			Sizes:  o.Sizes,
+		}
+	}
+
+	return p, nil
+}
+
+// srcsetHandler serves the <picture> description for the JSON request body as JSON
+func (s *server) srcsetHandler(w http.ResponseWriter, r *http.Request) {
+	var req srcsetRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+
+	var t image.Transform
+
+	if err == nil {
+		req.Output = ""
+		t, err = s.decodePublicImage(req.publicImage, r)
+	}
+
+	var p Picture
+
+	if err == nil {
+		p, err = buildPicture(SrcsetOptions{
+			Transform: t,
+			Widths:    req.Widths,
+			DPRs:      req.DPRs,
+			Formats:   req.Formats,
+			Sizes:     req.Sizes,
+			Base:      req.Base,
+		}, s.publicPath)
+	}
+
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Bad request: %v.", err), http.StatusBadRequest)
+		return
+	}
+
+	res, _ := json.MarshalIndent(p, "", "    ")
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(res)
+}
@@ -0,0 +1,109 @@
+package server
+
+import (
+	"math"
+
+	"github.com/henvic/picel/image"
+)
+
+var srcsetImage = image.Image{
+	ID:        "foo",
+	Extension: "jpg",
+	Source:    "https://example.net/foo.jpg",
+}
+
+var NewPictureCases = []NewPictureProvider{
+	{SrcsetOptions{
+		Transform: image.Transform{Image: srcsetImage},
+		Widths:    []int{320, 640},
+		Formats:   []string{"webp", "jpg"},
+		Sizes:     "100vw",
+	}, Picture{
+		Sources: []PictureSource{
+			{"image/webp", "/s:example.net/foo_320x_jpg.webp 320w, /s:example.net/foo_640x_jpg.webp 640w", "100vw"},
+		},
+		Image: PictureImage{
+			"/s:example.net/foo_320x.jpg",
+			"/s:example.net/foo_320x.jpg 320w, /s:example.net/foo_640x.jpg 640w",
+			"100vw",
+		},
+		Srcset: map[string]string{
+			"webp": "/s:example.net/foo_320x_jpg.webp 320w, /s:example.net/foo_640x_jpg.webp 640w",
+			"jpg":  "/s:example.net/foo_320x.jpg 320w, /s:example.net/foo_640x.jpg 640w",
+		},
+	}, nil},
+	{SrcsetOptions{
+		Transform: image.Transform{
+			Image:  srcsetImage,
+			Width:  400,
+			Height: 300,
+			Crop:   image.Crop{X: 1, Y: 2, Width: 800, Height: 600},
+		},
+		Widths:  []int{200},
+		Formats: []string{"png"},
+		Base:    "https://img.example.com/",
+	}, Picture{
+		Sources: []PictureSource{},
+		Image: PictureImage{
+			"https://img.example.com/s:example.net/foo_1x2:800x600_200x150_jpg.png",
+			"https://img.example.com/s:example.net/foo_1x2:800x600_200x150_jpg.png 200w",
+			"",
+		},
+		Srcset: map[string]string{
+			"png": "https://img.example.com/s:example.net/foo_1x2:800x600_200x150_jpg.png 200w",
+		},
+	}, nil},
+	{SrcsetOptions{
+		Transform: image.Transform{Image: srcsetImage, DPR: 2},
+		Widths:    []int{400},
+		Formats:   []string{"jpg"},
+	}, Picture{
+		Sources: []PictureSource{},
+		Image: PictureImage{
+			"/s:example.net/foo_400x.jpg",
+			"/s:example.net/foo_400x.jpg 400w",
+			"",
+		},
+		Srcset: map[string]string{
+			"jpg": "/s:example.net/foo_400x.jpg 400w",
+		},
+	}, nil},
+	{SrcsetOptions{
+		Transform: image.Transform{Image: srcsetImage, Width: 300},
+		DPRs:      []float64{1, 1.5, 2},
+		Formats:   []string{"jpg"},
+	}, Picture{
+		Sources: []PictureSource{},
+		Image: PictureImage{
+			"/s:example.net/foo_300x.jpg",
+			"/s:example.net/foo_300x.jpg 1x, /s:example.net/foo_300x_@1.5x.jpg 1.5x, /s:example.net/foo_300x_@2x.jpg 2x",
+			"",
+		},
+		Srcset: map[string]string{
+			"jpg": "/s:example.net/foo_300x.jpg 1x, /s:example.net/foo_300x_@1.5x.jpg 1.5x, /s:example.net/foo_300x_@2x.jpg 2x",
+		},
+	}, nil},
+	{SrcsetOptions{Formats: []string{"jpg"}}, Picture{}, ErrSrcsetMissingCandidates},
+	{SrcsetOptions{Widths: []int{1}, DPRs: []float64{1}, Formats: []string{"jpg"}}, Picture{}, ErrSrcsetBothCandidates},
+	{SrcsetOptions{Widths: []int{1}}, Picture{}, ErrSrcsetMissingFormats},
+	{SrcsetOptions{DPRs: []float64{2}, Formats: []string{"jpg"}}, Picture{}, ErrSrcsetMissingSize},
+	{SrcsetOptions{Transform: image.Transform{Width: 300}, DPRs: []float64{math.NaN()}, Formats: []string{"jpg"}}, Picture{}, ErrSrcsetInvalidCandidate},
+	{SrcsetOptions{Transform: image.Transform{Width: 300}, DPRs: []float64{math.Inf(1)}, Formats: []string{"jpg"}}, Picture{}, ErrSrcsetInvalidCandidate},
+	{SrcsetOptions{Widths: []int{0}, Formats: []string{"jpg"}}, Picture{}, ErrSrcsetInvalidCandidate},
+	{SrcsetOptions{Widths: []int{100}, Formats: []string{"webp", "bmp"}}, Picture{}, image.ErrOutputFormatNotSupported},
+	{SrcsetOptions{Widths: []int{100}, Formats: []string{""}}, Picture{}, image.ErrOutputFormatNotSupported},
+}
+
+var serverSrcsetWant = Picture{
+	Sources: []PictureSource{
+		{Type: "image/webp", Srcset: "https://img.example.com/foo_10x0:400x300_200x_png.webp 200w, https://img.example.com/foo_10x0:400x300_400x_png.webp 400w"},
+	},
+	Image: PictureImage{
+		Src:    "https://img.example.com/foo_10x0:400x300_200x_png.jpg",
+		Srcset: "https://img.example.com/foo_10x0:400x300_200x_png.jpg 200w, https://img.example.com/foo_10x0:400x300_400x_png.jpg 400w",
+	},
+	Srcset: map[string]string{
+		"webp": "https://img.example.com/foo_10x0:400x300_200x_png.webp 200w, https://img.example.com/foo_10x0:400x300_400x_png.webp 400w",
+		"jpg":  "https://img.example.com/foo_10x0:400x300_200x_png.jpg 200w, https://img.example.com/foo_10x0:400x300_400x_png.jpg 400w",
+	},
+}
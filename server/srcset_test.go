@@ -0,0 +1,68 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type NewPictureProvider struct {
+	o    SrcsetOptions
+	want Picture
+	err  error
+}
+
+func TestNewPicture(t *testing.T) {
+	// don't run in parallel due to mocking Backend
+	defaultBackend := Backend
+	Backend = ""
+
+	for _, c := range NewPictureCases {
+		got, err := NewPicture(c.o)
+
+		if err != c.err || (err == nil && !reflect.DeepEqual(got, c.want)) {
+			t.Errorf("NewPicture(%+v) == %+v, %v, want %+v, %v", c.o, got, err, c.want, c.err)
+		}
+	}
+
+	Backend = defaultBackend
+}
+
+func TestServerSrcset(t *testing.T) {
+	t.Parallel()
+	s := New(Options{
+		Backend: "https://example.net",
+	})
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/?srcset", strings.NewReader(`{
+		"path": "foo.png",
+		"crop": {"x": 10, "y": 0, "width": 400, "height": 300},
+		"widths": [200, 400],
+		"formats": ["webp", "jpg"],
+		"base": "https://img.example.com/"
+	}`))
+
+	s.ServeHTTP(w, req)
+
+	var got Picture
+
+	if err := json.Unmarshal(w.Body.Bytes(), &got); w.Code != http.StatusOK || err != nil {
+		t.Errorf("Request failed with %v: %v", w.Code, w.Body.String())
+	}
+
+	if !reflect.DeepEqual(got, serverSrcsetWant) {
+		t.Errorf("Got %+v, want %+v", got, serverSrcsetWant)
+	}
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("POST", "/?srcset", strings.NewReader(`{"path": "foo.png", "formats": ["webp"]}`))
+	s.ServeHTTP(w, req)
+
+	if w.Code != http.StatusBadRequest || w.Body.String() != "Bad request: Either widths or DPRs are required.\n" {
+		t.Errorf("Request should fail with %v, got %v with %v instead", http.StatusBadRequest, w.Code, w.Body.String())
+	}
+}
@@ -0,0 +1,145 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/henvic/picel/client"
+	"github.com/henvic/picel/image"
+)
+
+// ReadinessTimeout is the timeout for checking the programs used by the engines
+const ReadinessTimeout = 5 * time.Second
+
+// Status of the server
+type Status struct {
+	Circuits map[string]client.BreakerStatus `json:"circuits"`
+	Tools    []image.Tool                    `json:"tools"`
+}
+
+// Readiness of the server, with the result of each check ("ok" or the error)
+type Readiness struct {
+	Ready  bool              `json:"ready"`
+	Checks map[string]string `json:"checks"`
+}
+
+func getStatus(ctx context.Context, circuits *client.Circuits, p *image.Processor) Status {
+	s := Status{
+		Circuits: map[string]client.BreakerStatus{},
+		Tools:    p.Tools(ctx),
+	}
+
+	if circuits != nil {
+		s.Circuits = circuits.Status()
+	}
+
+	return s
+}
+
+// getReadiness checks if the programs used by the engines run, if the temporary directory is writable
+// and if the circuits of the configured backend and mirrors are not open
+// The hosts of the open mode are chosen by the clients, so their circuits are not checked
+func getReadiness(ctx context.Context, s *server) Readiness {
+	r := Readiness{
+		Ready:  true,
+		Checks: map[string]string{},
+	}
+
+	check := func(name string, failure string) {
+		r.Checks[name] = "ok"
+
+		if failure != "" {
+			r.Checks[name] = failure
+			r.Ready = false
+		}
+	}
+
+	for _, tool := range s.Processor.Tools(ctx) {
+		check(tool.Name, tool.Error)
+	}
+
+	var tempDirFailure string
+
+	if err := image.CheckTempDir(); err != nil {
+		tempDirFailure = err.Error()
+	}
+
+	check("tempDir", tempDirFailure)
+
+	var open []string
+
+	if s.Circuits != nil {
+		hosts := s.backendHosts()
+
+		for _, host := range s.Circuits.Open() {
+			if hosts[host] {
+				open = append(open, host)
+			}
+		}
+	}
+
+	var circuitsFailure string
+
+	if len(open) != 0 {
+		sort.Strings(open)
+		circuitsFailure = "open for " + strings.Join(open, ", ")
+	}
+
+	check("circuits", circuitsFailure)
+	return r
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	res, _ := json.MarshalIndent(v, "", "    ")
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	w.Write(res)
+}
+
+// StatusHandler serves the status of the server as JSON, using the package variables
+func StatusHandler(w http.ResponseWriter, r *http.Request) {
+	NewStatusHandler(options()).ServeHTTP(w, r)
+}
+
+// NewStatusHandler serves the status of a server created with the given options as JSON
+func NewStatusHandler(o Options) http.Handler {
+	s := newServer(o)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), ReadinessTimeout)
+		defer cancel()
+
+		writeJSON(w, http.StatusOK, getStatus(ctx, s.Circuits, s.Processor))
+	})
+}
+
+// HealthHandler tells the process is alive
+func HealthHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Write([]byte("ok\n"))
+}
+
+// NewReadyHandler serves the readiness of a server created with the given options as JSON
+// It fails with 503 Service Unavailable when not ready
+func NewReadyHandler(o Options) http.Handler {
+	s := newServer(o)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), ReadinessTimeout)
+		defer cancel()
+
+		readiness := getReadiness(ctx, s)
+		code := http.StatusOK
+
+		if !readiness.Ready {
+			code = http.StatusServiceUnavailable
+		}
+
+		writeJSON(w, code, readiness)
+	})
+}
@@ -0,0 +1,29 @@
+package server
+
+var ReadinessCases = []ReadinessProvider{
+	{[]string{"echo"}, "", nil, nil, true, map[string]string{
+		"echo":     "ok",
+		"tempDir":  "ok",
+		"circuits": "ok",
+	}},
+	{[]string{}, "b.example.net", map[string][]string{"b.example.net": {"a.example.net"}}, []string{"b.example.net", "a.example.net"}, false, map[string]string{
+		"tempDir":  "ok",
+		"circuits": "open for a.example.net, b.example.net",
+	}},
+	{[]string{}, "s:example.com", nil, []string{"example.com", "other.example.net"}, false, map[string]string{
+		"tempDir":  "ok",
+		"circuits": "open for example.com",
+	}},
+	{[]string{}, "", map[string][]string{"example.com": {"s:mirror.example.com"}}, []string{"mirror.example.com"}, false, map[string]string{
+		"tempDir":  "ok",
+		"circuits": "open for mirror.example.com",
+	}},
+	{[]string{}, "", nil, []string{"example.net"}, true, map[string]string{
+		"tempDir":  "ok",
+		"circuits": "ok",
+	}},
+	{[]string{}, "example.com", nil, []string{"example.net"}, true, map[string]string{
+		"tempDir":  "ok",
+		"circuits": "ok",
+	}},
+}
@@ -0,0 +1,125 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/henvic/picel/client"
+	"github.com/henvic/picel/image"
+)
+
+type ReadinessProvider struct {
+	programs []string
+	backend  string
+	mirrors  map[string][]string
+	open     []string
+	ready    bool
+	checks   map[string]string
+}
+
+func TestHealthHandler(t *testing.T) {
+	t.Parallel()
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/healthz", nil)
+	http.HandlerFunc(HealthHandler).ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK || w.Body.String() != "ok\n" {
+		t.Errorf("Health check returned %v with %q, want %v with %q", w.Code, w.Body.String(), http.StatusOK, "ok\n")
+	}
+}
+
+func TestReadyHandler(t *testing.T) {
+	t.Parallel()
+	for _, c := range ReadinessCases {
+		circuits := &client.Circuits{
+			Threshold: 1,
+			Cooldown:  time.Minute,
+		}
+
+		for _, host := range c.open {
+			circuits.Breaker(host).Failure()
+		}
+
+		h := NewReadyHandler(Options{
+			Backend:  c.backend,
+			Mirrors:  c.mirrors,
+			Circuits: circuits,
+			Processor: &image.Processor{
+				Programs: c.programs,
+			},
+		})
+
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/readyz", nil)
+		h.ServeHTTP(w, req)
+
+		var readiness Readiness
+
+		if err := json.Unmarshal(w.Body.Bytes(), &readiness); err != nil {
+			t.Errorf("Readiness response is not valid JSON: %v", err)
+		}
+
+		code := http.StatusOK
+
+		if !c.ready {
+			code = http.StatusServiceUnavailable
+		}
+
+		if w.Code != code || readiness.Ready != c.ready || !reflect.DeepEqual(readiness.Checks, c.checks) {
+			t.Errorf("Readiness for %v on backend %v with open circuits %v returned %v with %+v, want %v with %v",
+				c.programs, c.backend, c.open, w.Code, readiness, code, c.checks)
+		}
+	}
+}
+
+func TestReadyHandlerMissingProgram(t *testing.T) {
+	t.Parallel()
+	h := NewReadyHandler(Options{
+		Processor: &image.Processor{
+			Programs: []string{"echo", "picel-missing-program"},
+		},
+	})
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/readyz", nil)
+	h.ServeHTTP(w, req)
+
+	var readiness Readiness
+
+	if err := json.Unmarshal(w.Body.Bytes(), &readiness); err != nil {
+		t.Errorf("Readiness response is not valid JSON: %v", err)
+	}
+
+	if w.Code != http.StatusServiceUnavailable || readiness.Ready || readiness.Checks["echo"] != "ok" ||
+		readiness.Checks["picel-missing-program"] == "ok" || readiness.Checks["picel-missing-program"] == "" {
+		t.Errorf("Readiness with a missing program returned %v with %+v", w.Code, readiness)
+	}
+}
+
+func TestStatusTools(t *testing.T) {
+	t.Parallel()
+	h := NewStatusHandler(Options{
+		Processor: &image.Processor{
+			Programs: []string{"echo", "picel-missing-program"},
+		},
+	})
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/statusz", nil)
+	h.ServeHTTP(w, req)
+
+	var status Status
+
+	if err := json.Unmarshal(w.Body.Bytes(), &status); err != nil {
+		t.Errorf("Status response is not valid JSON: %v", err)
+	}
+
+	if len(status.Tools) != 2 || status.Tools[0] != (image.Tool{Name: "echo", Version: "-version"}) ||
+		status.Tools[1].Name != "picel-missing-program" || status.Tools[1].Error == "" {
+		t.Errorf("Status tools == %+v, want echo with version -version and a missing program", status.Tools)
+	}
+}
@@ -0,0 +1,214 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+
+	"github.com/henvic/picel/client"
+	"github.com/henvic/picel/image"
+)
+
+const maxUploadTransformSize = 64 << 10
+
+var (
+	// ErrUploadTooLarge is returned when the upload request body is larger than the maximum upload size
+	ErrUploadTooLarge = errors.New("Upload exceeds the maximum upload size")
+
+	// ErrMissingUploadImage is returned when a multipart upload has no image part
+	ErrMissingUploadImage = errors.New("Missing image")
+)
+
+// uploadBody fails with ErrUploadTooLarge when more than n bytes are read
+type uploadBody struct {
+	body     io.Reader
+	n        int64
+	exceeded bool
+}
+
+func (u *uploadBody) Read(p []byte) (n int, err error) {
+	if u.exceeded {
+		return 0, ErrUploadTooLarge
+	}
+
+	n, err = u.body.Read(p)
+	u.n -= int64(n)
+
+	if u.n < 0 {
+		u.exceeded = true
+		return n, ErrUploadTooLarge
+	}
+
+	return n, err
+}
+
+func isUpload(r *http.Request) bool {
+	return r.Method == "POST" || r.Method == "PUT"
+}
+
+// readMultipartUpload reads the image and transform parts of a multipart/form-data upload
+func readMultipartUpload(r *http.Request, source *bytes.Buffer) (path string, err error) {
+	mr, err := r.MultipartReader()
+
+	if err != nil {
+		return "", err
+	}
+
+	var found bool
+	var pi publicImage
+
+	for {
+		part, partErr := mr.NextPart()
+
+		if partErr == io.EOF {
+			break
+		}
+
+		if partErr != nil {
+			return "", partErr
+		}
+
+		switch part.FormName() {
+		case "image":
+			_, err = source.ReadFrom(part)
+			found = true
+		case "transform":
+			err = json.NewDecoder(io.LimitReader(part, maxUploadTransformSize)).Decode(&pi)
+		default:
+			_, err = io.Copy(ioutil.Discard, part)
+		}
+
+		part.Close()
+
+		if err != nil {
+			return "", err
+		}
+	}
+
+	if !found {
+		return "", ErrMissingUploadImage
+	}
+
+	// the backend is meaningless for uploads
+	pi.Backend = ""
+
+	return encodePublicImage(pi)
+}
+
+// prepareUpload reads the upload, decoding the transformation from the multipart transform part or from the URL path
+func (s *server) prepareUpload(r *http.Request, source *bytes.Buffer) (transform image.Transform, reqPath string, errs []error, err error) {
+	body := &uploadBody{
+		body: r.Body,
+		n:    s.MaxUploadSize,
+	}
+
+	if s.MaxUploadSize > 0 {
+		r.Body = ioutil.NopCloser(body)
+	}
+
+	reqPath = r.URL.Path[1:]
+
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+
+	switch {
+	case s.MaxUploadSize > 0 && r.ContentLength > s.MaxUploadSize:
+		body.exceeded = true
+	case mediaType == "multipart/form-data":
+		var p string
+		p, err = readMultipartUpload(r, source)
+
+		if len(p) != 0 {
+			reqPath = p[1:]
+		}
+	default:
+		_, err = source.ReadFrom(r.Body)
+	}
+
+	if body.exceeded {
+		err = ErrUploadTooLarge
+	}
+
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	transform, errsDecode, decodeErr := image.Decode(reqPath, getDefaultRequestOutputFormat(r))
+	errs = append(errs, errsDecode...)
+
+	if err == nil {
+		err = decodeErr
+	}
+
+	return transform, reqPath, errs, err
+}
+
+// checkUpload validates the type of the uploaded image, using it as the input extension
+func (s *server) checkUpload(t *image.Transform, source *bytes.Buffer) (m client.Metadata, err error) {
+	m = client.Metadata{
+		Size:        int64(source.Len()),
+		ContentType: image.TypeByBuffer(source.Bytes()),
+	}
+
+	if !s.inputMimeTypes()[m.ContentType] {
+		return m, image.ErrMimeTypeNotSupported
+	}
+
+	if extension, ok := image.InputExtensions[m.ContentType]; ok {
+		t.Image.Extension = extension
+	}
+
+	t.Image.Source = ""
+	return m, nil
+}
+
+func (s *server) explainUpload(path string, t image.Transform, errs []error, err error, source *bytes.Buffer, w http.ResponseWriter) {
+	var se *SourceExplain
+
+	if err == nil {
+		m, checkErr := s.checkUpload(&t, source)
+		se = &SourceExplain{
+			Metadata: m,
+		}
+
+		if checkErr != nil {
+			se.Error = fmt.Sprintf("%v", checkErr)
+		}
+	}
+
+	e := buildExplain(path, t, err, errs)
+	e.Source = se
+
+	w.Header().Set("Content-Type", "application/json")
+	fmt.Fprint(w, jsonEncodeExplain(e))
+}
+
+func (s *server) uploadHandler(w http.ResponseWriter, r *http.Request) {
+	var source bytes.Buffer
+	transform, path, errs, err := s.prepareUpload(r, &source)
+
+	if r.URL.Query()["explain"] != nil {
+		s.explainUpload("/"+path, transform, errs, err, &source, w)
+		return
+	}
+
+	switch {
+	case err == ErrUploadTooLarge:
+		http.Error(w, "Upload too large.", http.StatusRequestEntityTooLarge)
+		return
+	case err != nil:
+		http.Error(w, "Bad request.", http.StatusBadRequest)
+		return
+	}
+
+	if _, err = s.checkUpload(&transform, &source); err != nil {
+		http.Error(w, err.Error()+".", http.StatusUnsupportedMediaType)
+		return
+	}
+
+	s.processingHandler(&source, transform, w, r)
+}
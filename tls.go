@@ -0,0 +1,165 @@
+package main
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/henvic/picel/logger"
+)
+
+var (
+	tlsCert      string
+	tlsKey       string
+	redirectAddr string
+	h2c          bool
+
+	// ErrTLSKeyPair is returned when only one of the certificate and key files is given
+	ErrTLSKeyPair = errors.New("Both --tls-cert and --tls-key are required for TLS")
+
+	// ErrRedirectWithoutTLS is returned when the HTTP to HTTPS redirect is used without TLS
+	ErrRedirectWithoutTLS = errors.New("--redirect-addr requires TLS")
+
+	// ErrH2CWithTLS is returned when h2c is used with TLS
+	ErrH2CWithTLS = errors.New("--h2c can't be used with TLS (HTTP/2 is enabled on TLS already)")
+)
+
+// certReloader loads a certificate, reloading it when the certificate or key files change
+type certReloader struct {
+	certFile string
+	keyFile  string
+	mutex    sync.RWMutex
+	cert     *tls.Certificate
+	modTime  time.Time
+}
+
+func newCertReloader(certFile, keyFile string) (*certReloader, error) {
+	c := &certReloader{
+		certFile: certFile,
+		keyFile:  keyFile,
+	}
+
+	return c, c.reload()
+}
+
+// modified returns the latest modification time of the certificate and key files
+func (c *certReloader) modified() (modTime time.Time, err error) {
+	for _, name := range []string{c.certFile, c.keyFile} {
+		info, err := os.Stat(name)
+
+		if err != nil {
+			return modTime, err
+		}
+
+		if info.ModTime().After(modTime) {
+			modTime = info.ModTime()
+		}
+	}
+
+	return modTime, nil
+}
+
+func (c *certReloader) reload() error {
+	modTime, err := c.modified()
+
+	if err != nil {
+		return err
+	}
+
+	cert, err := tls.LoadX509KeyPair(c.certFile, c.keyFile)
+
+	if err != nil {
+		return err
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.cert = &cert
+	c.modTime = modTime
+	return nil
+}
+
+// GetCertificate for tls.Config, reloading the certificate when the files changed
+// The current certificate is kept when reloading fails (i.e., when the key is yet to be replaced)
+func (c *certReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	c.mutex.RLock()
+	loaded := c.modTime
+	c.mutex.RUnlock()
+
+	if modTime, err := c.modified(); err == nil && !modTime.Equal(loaded) {
+		if err := c.reload(); err != nil {
+			logger.Stderr.Println(fmt.Sprintf("Failed to reload the TLS certificate: %v", err))
+		}
+	}
+
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	return c.cert, nil
+}
+
+func validateTLSFlags() error {
+	switch {
+	case (tlsCert == "") != (tlsKey == ""):
+		return ErrTLSKeyPair
+	case redirectAddr != "" && tlsCert == "":
+		return ErrRedirectWithoutTLS
+	case h2c && tlsCert != "":
+		return ErrH2CWithTLS
+	}
+
+	return nil
+}
+
+// setupTLS configures the server to serve HTTPS (with HTTP/2) or h2c
+func setupTLS(srv *http.Server) error {
+	if h2c {
+		srv.Protocols = &http.Protocols{}
+		srv.Protocols.SetHTTP1(true)
+		srv.Protocols.SetUnencryptedHTTP2(true)
+	}
+
+	if tlsCert == "" {
+		return nil
+	}
+
+	certs, err := newCertReloader(tlsCert, tlsKey)
+
+	if err != nil {
+		return err
+	}
+
+	srv.TLSConfig = &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: certs.GetCertificate,
+	}
+
+	return nil
+}
+
+// redirectHandler redirects HTTP requests to HTTPS on the port of httpsAddr
+func redirectHandler(httpsAddr string) http.Handler {
+	_, port, _ := net.SplitHostPort(httpsAddr)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := strings.Trim(r.Host, "[]")
+
+		if h, _, err := net.SplitHostPort(r.Host); err == nil {
+			host = h
+		}
+
+		switch {
+		case port != "" && port != "443":
+			host = net.JoinHostPort(host, port)
+		case strings.Contains(host, ":"):
+			host = "[" + host + "]"
+		}
+
+		http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), http.StatusMovedPermanently)
+	})
+}
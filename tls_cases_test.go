@@ -0,0 +1,21 @@
+package main
+
+var ValidateTLSFlagsCases = []ValidateTLSFlagsProvider{
+	{"", "", "", false, nil},
+	{"cert.pem", "key.pem", "", false, nil},
+	{"cert.pem", "key.pem", ":80", false, nil},
+	{"", "", "", true, nil},
+	{"cert.pem", "", "", false, ErrTLSKeyPair},
+	{"", "key.pem", "", false, ErrTLSKeyPair},
+	{"", "", ":80", false, ErrRedirectWithoutTLS},
+	{"cert.pem", "key.pem", "", true, ErrH2CWithTLS},
+}
+
+var RedirectCases = []RedirectProvider{
+	{":443", "example.com", "/foo.jpg?explain", "https://example.com/foo.jpg?explain"},
+	{":443", "example.com:80", "/foo.jpg", "https://example.com/foo.jpg"},
+	{":8443", "example.com:8080", "/foo.jpg", "https://example.com:8443/foo.jpg"},
+	{"127.0.0.1:8443", "localhost", "/", "https://localhost:8443/"},
+	{":443", "[::1]:80", "/foo.jpg", "https://[::1]/foo.jpg"},
+	{":8443", "[::1]", "/foo.jpg", "https://[::1]:8443/foo.jpg"},
+}
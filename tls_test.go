@@ -0,0 +1,257 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+)
+
+type ValidateTLSFlagsProvider struct {
+	cert     string
+	key      string
+	redirect string
+	h2c      bool
+	err      error
+}
+
+type RedirectProvider struct {
+	httpsAddr string
+	host      string
+	uri       string
+	location  string
+}
+
+// writeCertificate writes a self-signed certificate for localhost with the given serial number
+func writeCertificate(t *testing.T, certFile string, keyFile string, serial int64, modTime time.Time) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		DNSNames:     []string{"localhost"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ioutil.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	os.Chtimes(certFile, modTime, modTime)
+	os.Chtimes(keyFile, modTime, modTime)
+}
+
+func getSerial(t *testing.T, c *certReloader) int64 {
+	cert, err := c.GetCertificate(nil)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return leaf.SerialNumber.Int64()
+}
+
+func TestValidateTLSFlags(t *testing.T) {
+	// don't run in parallel due to mocking the TLS flags
+	defaultTLSCert, defaultTLSKey, defaultRedirectAddr, defaultH2C := tlsCert, tlsKey, redirectAddr, h2c
+
+	defer func() {
+		tlsCert, tlsKey, redirectAddr, h2c = defaultTLSCert, defaultTLSKey, defaultRedirectAddr, defaultH2C
+	}()
+
+	for _, c := range ValidateTLSFlagsCases {
+		tlsCert, tlsKey, redirectAddr, h2c = c.cert, c.key, c.redirect, c.h2c
+
+		if err := validateTLSFlags(); err != c.err {
+			t.Errorf("validateTLSFlags() for %+v == %v, want %v", c, err, c.err)
+		}
+	}
+}
+
+func TestRedirectHandler(t *testing.T) {
+	t.Parallel()
+	for _, c := range RedirectCases {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", c.uri, nil)
+		req.Host = c.host
+		redirectHandler(c.httpsAddr).ServeHTTP(w, req)
+
+		if w.Code != http.StatusMovedPermanently || w.Header().Get("Location") != c.location {
+			t.Errorf("Redirect of %v%v for %v == %v to %v, want %v to %v",
+				c.host, c.uri, c.httpsAddr, w.Code, w.Header().Get("Location"), http.StatusMovedPermanently, c.location)
+		}
+	}
+}
+
+func TestCertReloader(t *testing.T) {
+	t.Parallel()
+	dir, err := ioutil.TempDir("", "picel")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	now := time.Now()
+	writeCertificate(t, certFile, keyFile, 1, now.Add(-time.Hour))
+
+	c, err := newCertReloader(certFile, keyFile)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if serial := getSerial(t, c); serial != 1 {
+		t.Errorf("Certificate serial number == %v, want 1", serial)
+	}
+
+	writeCertificate(t, certFile, keyFile, 2, now)
+
+	if serial := getSerial(t, c); serial != 2 {
+		t.Errorf("Certificate should be reloaded, got serial number %v instead", serial)
+	}
+
+	// a certificate without its key should not replace the current certificate
+	if err := ioutil.WriteFile(keyFile, []byte("invalid"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	os.Chtimes(keyFile, now.Add(time.Hour), now.Add(time.Hour))
+
+	if serial := getSerial(t, c); serial != 2 {
+		t.Errorf("Certificate should be kept when reloading fails, got serial number %v instead", serial)
+	}
+}
+
+func TestServeTLSWithHTTP2(t *testing.T) {
+	// don't run in parallel due to mocking the TLS flags
+	defaultTLSCert, defaultTLSKey := tlsCert, tlsKey
+
+	defer func() {
+		tlsCert, tlsKey = defaultTLSCert, defaultTLSKey
+	}()
+
+	dir, err := ioutil.TempDir("", "picel")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	tlsCert, tlsKey = filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	writeCertificate(t, tlsCert, tlsKey, 1, time.Now())
+
+	url, stop, done := startServe(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Proto))
+	}, setupTLS)
+
+	c := &http.Client{
+		Transport: &http.Transport{
+			TLSClientConfig:   &tls.Config{InsecureSkipVerify: true},
+			ForceAttemptHTTP2: true,
+		},
+	}
+
+	resp, err := c.Get(url)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	body, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	if string(body) != "HTTP/2.0" {
+		t.Errorf("Request over TLS should use HTTP/2, got %v instead", string(body))
+	}
+
+	stop <- syscall.SIGTERM
+
+	if err := <-done; err != nil {
+		t.Errorf("serve() should stop without errors, got %v instead", err)
+	}
+}
+
+func TestServeH2C(t *testing.T) {
+	// don't run in parallel due to mocking h2c
+	defaultH2C := h2c
+	h2c = true
+
+	defer func() {
+		h2c = defaultH2C
+	}()
+
+	url, stop, done := startServe(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Proto))
+	}, setupTLS)
+
+	protocols := &http.Protocols{}
+	protocols.SetUnencryptedHTTP2(true)
+
+	c := &http.Client{
+		Transport: &http.Transport{
+			Protocols: protocols,
+		},
+	}
+
+	resp, err := c.Get(url)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	body, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	if string(body) != "HTTP/2.0" {
+		t.Errorf("Request with h2c should use HTTP/2, got %v instead", string(body))
+	}
+
+	stop <- syscall.SIGTERM
+
+	if err := <-done; err != nil {
+		t.Errorf("serve() should stop without errors, got %v instead", err)
+	}
+}
@@ -0,0 +1,263 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/henvic/picel/server"
+)
+
+// ErrWarmServer is returned when the server to warm is not a HTTP(S) URL
+var ErrWarmServer = errors.New("--server must be a http:// or https:// URL")
+
+// warmResult of requesting a rendition
+type warmResult struct {
+	path     string
+	code     int
+	err      error
+	invalid  bool
+	duration time.Duration
+}
+
+func (r warmResult) failed() bool {
+	return r.err != nil || r.code >= 400
+}
+
+// failureType of a result, for grouping the failures on the summary
+func (r warmResult) failureType() string {
+	var ne net.Error
+	var oe *net.OpError
+
+	switch {
+	case r.invalid:
+		return "invalid line"
+	case r.err == nil:
+		return fmt.Sprintf("%d %s", r.code, http.StatusText(r.code))
+	case errors.As(r.err, &ne) && ne.Timeout():
+		return "timeout"
+	case errors.As(r.err, &oe):
+		return oe.Op + " error"
+	case r.code != 0:
+		return "read error"
+	}
+
+	return "request error"
+}
+
+// readWarmList reads the paths to warm, one per line, given as picel paths or JSON transformations on the request body format
+// Empty lines and lines starting with # are skipped
+func readWarmList(r io.Reader) (paths []string, invalid []warmResult, err error) {
+	scanner := bufio.NewScanner(r)
+
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+
+		switch {
+		case line == "" || strings.HasPrefix(line, "#"):
+		case strings.HasPrefix(line, "{"):
+			path, err := server.EncodeRequest(strings.NewReader(line))
+
+			if err != nil {
+				invalid = append(invalid, warmResult{path: line, err: err, invalid: true})
+				continue
+			}
+
+			paths = append(paths, path)
+		default:
+			paths = append(paths, "/"+strings.TrimPrefix(line, "/"))
+		}
+	}
+
+	return paths, invalid, scanner.Err()
+}
+
+// warmPath requests a rendition, reading the whole response so that the caches in the way store it
+func warmPath(c *http.Client, serverURL, path, accept string) warmResult {
+	start := time.Now()
+	r := warmResult{
+		path: path,
+	}
+
+	req, err := http.NewRequest("GET", serverURL+path, nil)
+
+	if err != nil {
+		r.err = err
+		return r
+	}
+
+	if accept != "" {
+		req.Header.Set("Accept", accept)
+	}
+
+	resp, err := c.Do(req)
+
+	if err == nil {
+		r.code = resp.StatusCode
+		_, err = io.Copy(ioutil.Discard, resp.Body)
+		resp.Body.Close()
+	}
+
+	r.err = err
+	r.duration = time.Since(start)
+	return r
+}
+
+// warm requests the paths with up to concurrency requests at a time, writing the progress to w
+func warm(c *http.Client, serverURL string, paths []string, concurrency int, accept string, w io.Writer) (failures []warmResult) {
+	queue := make(chan string)
+	results := make(chan warmResult)
+	var wg sync.WaitGroup
+
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for path := range queue {
+				results <- warmPath(c, serverURL, path, accept)
+			}
+		}()
+	}
+
+	go func() {
+		for _, path := range paths {
+			queue <- path
+		}
+
+		close(queue)
+		wg.Wait()
+		close(results)
+	}()
+
+	var done int
+
+	for r := range results {
+		done++
+		status := fmt.Sprintf("%d", r.code)
+
+		if r.err != nil {
+			status = r.err.Error()
+		}
+
+		fmt.Fprintf(w, "[%d/%d] %v %v (%v)\n", done, len(paths), status, r.path, r.duration.Round(time.Millisecond))
+
+		if r.failed() {
+			failures = append(failures, r)
+		}
+	}
+
+	return failures
+}
+
+// writeWarmSummary writes the number of failures by type, most common first
+func writeWarmSummary(w io.Writer, total int, failures []warmResult, duration time.Duration) {
+	fmt.Fprintf(w, "Warmed %d of %d paths in %v\n", total-len(failures), total, duration.Round(time.Millisecond))
+
+	if len(failures) == 0 {
+		return
+	}
+
+	byType := map[string]int{}
+	var types []string
+
+	for _, f := range failures {
+		if byType[f.failureType()] == 0 {
+			types = append(types, f.failureType())
+		}
+
+		byType[f.failureType()]++
+	}
+
+	sort.Slice(types, func(i, j int) bool {
+		if byType[types[i]] != byType[types[j]] {
+			return byType[types[i]] > byType[types[j]]
+		}
+
+		return types[i] < types[j]
+	})
+
+	fmt.Fprintln(w, "Failures:")
+
+	for _, t := range types {
+		fmt.Fprintf(w, "%6d %v\n", byType[t], t)
+	}
+}
+
+func warmCommand(args []string, stdin io.Reader, stdout io.Writer, stderr io.Writer) int {
+	var (
+		serverURL   string
+		concurrency int
+		timeout     time.Duration
+		accept      string
+	)
+
+	fs := newCommandFlagSet("warm", "[flags] [file]", stderr)
+	fs.StringVar(&serverURL, "server", "http://localhost"+defaultAddr, "URL of the picel server (or of the cache in front of it)")
+	fs.IntVar(&concurrency, "concurrency", 4, "Number of concurrent requests")
+	fs.DurationVar(&timeout, "timeout", 30*time.Second, "Timeout for each request")
+	fs.StringVar(&accept, "accept", "", "Accept header of the requests (i.e., image/webp for the WebP renditions)")
+
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	if fs.NArg() > 1 || concurrency < 1 {
+		fs.Usage()
+		return 2
+	}
+
+	if !strings.HasPrefix(serverURL, "http://") && !strings.HasPrefix(serverURL, "https://") {
+		fmt.Fprintln(stderr, ErrWarmServer)
+		return 2
+	}
+
+	input := stdin
+
+	if name := fs.Arg(0); name != "" && name != "-" {
+		file, err := os.Open(name)
+
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			return 1
+		}
+
+		defer file.Close()
+		input = file
+	}
+
+	paths, invalid, err := readWarmList(input)
+
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+
+	for _, r := range invalid {
+		fmt.Fprintf(stderr, "Invalid line %v: %v\n", r.path, r.err)
+	}
+
+	start := time.Now()
+	c := &http.Client{
+		Timeout: timeout,
+	}
+
+	failures := append(invalid, warm(c, strings.TrimSuffix(serverURL, "/"), paths, concurrency, accept, stderr)...)
+	writeWarmSummary(stdout, len(paths)+len(invalid), failures, time.Since(start))
+
+	if len(failures) != 0 {
+		return 1
+	}
+
+	return 0
+}
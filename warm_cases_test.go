@@ -0,0 +1,32 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/url"
+)
+
+var ReadWarmListCases = []ReadWarmListProvider{
+	{"", nil, 0},
+	{"/example.net/foo_400x.webp\nexample.net/bar.jpg\n\n# comment\n", []string{"/example.net/foo_400x.webp", "/example.net/bar.jpg"}, 0},
+	{`{"backend": "example.net", "path": "a.jpg", "width": 300, "output": "webp"}` + "\n" + `{"width": 300}` + "\n{\n",
+		[]string{"/example.net/a_300x_jpg.webp"}, 2},
+}
+
+var WarmCommandCases = []WarmCommandProvider{
+	{"/foo_400x.webp\n/bar.jpg\n", 0, 2, "Warmed 2 of 2 paths"},
+	{"/foo_400x.webp\n/missing.jpg\n/missing.png\n/fail.jpg\n{\n", 1, 4,
+		"Warmed 1 of 5 paths in 0s\nFailures:\n     2 404 Not Found\n     1 500 Internal Server Error\n     1 invalid line\n"},
+}
+
+var FailureTypeCases = []FailureTypeProvider{
+	{warmResult{code: 404}, "404 Not Found"},
+	{warmResult{path: "{", err: errors.New("unexpected EOF"), invalid: true}, "invalid line"},
+	{warmResult{err: &url.Error{Op: "Get", URL: "http://localhost/", Err: context.DeadlineExceeded}}, "timeout"},
+	{warmResult{err: &url.Error{Op: "Get", URL: "http://localhost/", Err: &net.OpError{Op: "dial", Err: errors.New("refused")}}}, "dial error"},
+	{warmResult{code: 200, err: &net.OpError{Op: "read", Err: errors.New("reset")}}, "read error"},
+	{warmResult{code: 200, err: io.ErrUnexpectedEOF}, "read error"},
+	{warmResult{err: &url.Error{Op: "Get", URL: "ftp://localhost/", Err: errors.New("unsupported protocol scheme")}}, "request error"},
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+)
+
+type ReadWarmListProvider struct {
+	list    string
+	paths   []string
+	invalid int
+}
+
+type FailureTypeProvider struct {
+	result warmResult
+	want   string
+}
+
+type WarmCommandProvider struct {
+	list     string
+	status   int
+	progress int
+	out      string
+}
+
+func TestReadWarmList(t *testing.T) {
+	t.Parallel()
+	for _, c := range ReadWarmListCases {
+		paths, invalid, err := readWarmList(strings.NewReader(c.list))
+
+		if !reflect.DeepEqual(paths, c.paths) || len(invalid) != c.invalid || err != nil {
+			t.Errorf("readWarmList(%q) == %v, %v, %v, want %v with %v invalid lines", c.list, paths, invalid, err, c.paths, c.invalid)
+		}
+	}
+}
+
+func TestFailureType(t *testing.T) {
+	t.Parallel()
+	for _, c := range FailureTypeCases {
+		if got := c.result.failureType(); got != c.want {
+			t.Errorf("failureType() of %+v == %q, want %q", c.result, got, c.want)
+		}
+	}
+}
+
+func TestWarmCommand(t *testing.T) {
+	t.Parallel()
+	var mutex sync.Mutex
+	requested := map[string]string{}
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		requested[r.URL.Path] = r.Header.Get("Accept")
+		mutex.Unlock()
+
+		switch {
+		case strings.HasPrefix(r.URL.Path, "/missing"):
+			http.NotFound(w, r)
+		case strings.HasPrefix(r.URL.Path, "/fail"):
+			http.Error(w, "failure", http.StatusInternalServerError)
+		default:
+			w.Write([]byte("image"))
+		}
+	}))
+
+	defer ts.Close()
+
+	duration := regexp.MustCompile(`in [0-9.]+[µnm]?s`)
+	progress := regexp.MustCompile(`(?m)^\[`)
+
+	for _, c := range WarmCommandCases {
+		var stdout, stderr bytes.Buffer
+		status := warmCommand([]string{"--server", ts.URL + "/", "--accept", "image/webp", "--concurrency", "2"},
+			strings.NewReader(c.list), &stdout, &stderr)
+		out := duration.ReplaceAllString(stdout.String(), "in 0s")
+
+		if status != c.status || !strings.HasPrefix(out, c.out) {
+			t.Errorf("warm %q returned %v with %q, want %v with %q", c.list, status, out, c.status, c.out)
+		}
+
+		if len(progress.FindAllString(stderr.String(), -1)) != c.progress {
+			t.Errorf("warm %q should write the progress of each path, got %q instead", c.list, stderr.String())
+		}
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	if requested["/foo_400x.webp"] != "image/webp" || len(requested) != 5 {
+		t.Errorf("Unexpected requests: %v", requested)
+	}
+}
+
+func TestWarmCommandConnectionFailure(t *testing.T) {
+	t.Parallel()
+	ts := httptest.NewServer(http.NotFoundHandler())
+	url := ts.URL
+	ts.Close()
+
+	var stdout, stderr bytes.Buffer
+	status := warmCommand([]string{"--server", url}, strings.NewReader("/foo.jpg\n"), &stdout, &stderr)
+
+	if status != 1 || !strings.Contains(stdout.String(), "1 dial error") {
+		t.Errorf("warm with the server down returned %v with %q, want failure with dial error", status, stdout.String())
+	}
+}
+
+func TestWarmCommandReadFailure(t *testing.T) {
+	t.Parallel()
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", "10")
+		w.Write([]byte("image"))
+	}))
+
+	defer ts.Close()
+
+	var stdout, stderr bytes.Buffer
+	status := warmCommand([]string{"--server", ts.URL}, strings.NewReader("/foo.jpg\n"), &stdout, &stderr)
+
+	if status != 1 || !strings.Contains(stdout.String(), "1 read error") {
+		t.Errorf("warm with a truncated response returned %v with %q, want failure with read error", status, stdout.String())
+	}
+}
+
+func TestWarmCommandInvalidFlags(t *testing.T) {
+	t.Parallel()
+	for _, args := range [][]string{
+		{"--server", "localhost:8123"},
+		{"--concurrency", "0"},
+		{"a.txt", "b.txt"},
+	} {
+		var stdout, stderr bytes.Buffer
+
+		if status := warmCommand(args, strings.NewReader(""), &stdout, &stderr); status != 2 {
+			t.Errorf("warm %v returned %v, want 2", args, status)
+		}
+	}
+}